@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/marpit19/zap-pm/internal/cli"
 	"github.com/marpit19/zap-pm/internal/logger"
@@ -13,9 +16,14 @@ func main() {
 	// Initialize logger
 	log := logger.New()
 
+	// Cancel running requests and downloads on Ctrl-C or termination
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
 	// Initialize and execute root command
 	rootCmd := cli.NewRootCommand(log)
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
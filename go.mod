@@ -9,7 +9,6 @@ require (
 )
 
 require (
-	github.com/Masterminds/semver/v3 v3.3.0
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
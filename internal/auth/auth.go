@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/marpit19/zap-pm/internal/npmrc"
+)
+
+// Provider supplies the Authorization header for a request URL
+type Provider interface {
+	// Authorization returns the header value for url, or an empty string
+	// when the request is sent without credentials
+	Authorization(url string) (string, error)
+}
+
+// NpmrcProvider authenticates requests with the credentials configured in
+// .npmrc, matching each URL against the //host/path/ keys they are scoped to
+type NpmrcProvider struct {
+	config *npmrc.Config
+}
+
+// NewNpmrcProvider creates a provider for the credentials in config
+func NewNpmrcProvider(config *npmrc.Config) *NpmrcProvider {
+	return &NpmrcProvider{config: config}
+}
+
+// Authorization returns a bearer token when one is configured for url and
+// basic credentials otherwise. A URL covered by always-auth without
+// credentials is an error.
+func (p *NpmrcProvider) Authorization(url string) (string, error) {
+	creds := p.config.Credentials(url)
+	switch {
+	case creds.Token != "":
+		return "Bearer " + creds.Token, nil
+	case creds.Auth != "":
+		return "Basic " + creds.Auth, nil
+	case creds.Username != "" && creds.Password != "":
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(creds.Username+":"+creds.Password)), nil
+	}
+
+	if p.config.AlwaysAuth(url) {
+		return "", fmt.Errorf("always-auth is set for %s but no credentials are configured", url)
+	}
+	return "", nil
+}
+
+// Transport attaches credentials to each request based on its own URL.
+// Redirects are separate requests through the transport, so a token is
+// never forwarded to a host it was not configured for.
+type Transport struct {
+	Base     http.RoundTripper
+	Provider Provider
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if req.Header.Get("Authorization") != "" {
+		return base.RoundTrip(req)
+	}
+
+	header, err := t.Provider.Authorization(req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	if header == "" {
+		return base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", header)
+	return base.RoundTrip(req)
+}
+
+// Wrap makes client authenticate its requests with provider
+func Wrap(client *http.Client, provider Provider) {
+	client.Transport = &Transport{Base: client.Transport, Provider: provider}
+}
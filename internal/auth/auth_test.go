@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marpit19/zap-pm/internal/npmrc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNpmrcProviderAuthorization(t *testing.T) {
+	provider := NewNpmrcProvider(npmrc.New(map[string]string{
+		"//token.example.com/:_authToken":   "s3cret",
+		"//basic.example.com/:username":     "alice",
+		"//basic.example.com/:_password":    "aHVudGVyMg==",
+		"//legacy.example.com/:_auth":       "YWxpY2U6aHVudGVyMg==",
+		"//always.example.com/:always-auth": "true",
+	}))
+
+	tests := []struct {
+		url       string
+		expected  string
+		expectErr bool
+	}{
+		{url: "https://token.example.com/pkg", expected: "Bearer s3cret"},
+		{url: "https://token.example.com/pkg/-/pkg-1.0.0.tgz", expected: "Bearer s3cret"},
+		{url: "https://basic.example.com/pkg", expected: "Basic YWxpY2U6aHVudGVyMg=="},
+		{url: "https://legacy.example.com/pkg", expected: "Basic YWxpY2U6aHVudGVyMg=="},
+		{url: "https://other.example.com/pkg", expected: ""},
+		{url: "https://always.example.com/pkg", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			header, err := provider.Authorization(tt.url)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, header)
+		})
+	}
+}
+
+func TestGlobalAlwaysAuthOnlyCoversRegistry(t *testing.T) {
+	provider := NewNpmrcProvider(npmrc.New(map[string]string{
+		"registry":    "https://npm.example.com/",
+		"always-auth": "true",
+		"_authToken":  "s3cret",
+	}))
+
+	header, err := provider.Authorization("https://npm.example.com/pkg")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer s3cret", header)
+
+	// Third party tarball hosts are fetched without credentials
+	header, err = provider.Authorization("https://cdn.example.org/pkg.tgz")
+	require.NoError(t, err)
+	assert.Empty(t, header)
+}
+
+func TestTransportDoesNotLeakOnRedirect(t *testing.T) {
+	var cdnAuth string
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnAuth = r.Header.Get("Authorization")
+		w.Write([]byte("tarball"))
+	}))
+	defer cdn.Close()
+
+	var registryAuth string
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registryAuth = r.Header.Get("Authorization")
+		http.Redirect(w, r, cdn.URL+"/pkg.tgz", http.StatusFound)
+	}))
+	defer registry.Close()
+
+	// The servers differ by port, which is part of the credential scope
+	cfg := npmrc.New(map[string]string{
+		npmrc.NerfDarts(registry.URL + "/")[0] + ":_authToken": "s3cret",
+	})
+	client := &http.Client{}
+	Wrap(client, NewNpmrcProvider(cfg))
+
+	resp, err := client.Get(registry.URL + "/pkg/-/pkg-1.0.0.tgz")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "Bearer s3cret", registryAuth)
+	assert.Empty(t, cdnAuth)
+}
+
+func TestTransportKeepsExplicitAuthorization(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	cfg := npmrc.New(map[string]string{
+		npmrc.NerfDarts(server.URL + "/")[0] + ":_authToken": "configured",
+	})
+	client := &http.Client{}
+	Wrap(client, NewNpmrcProvider(cfg))
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer explicit")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "Bearer explicit", received)
+}
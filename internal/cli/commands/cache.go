@@ -0,0 +1,260 @@
+package commands
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/marpit19/zap-pm/internal/downloader"
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/marpit19/zap-pm/internal/registry"
+	"github.com/spf13/cobra"
+)
+
+// NewCacheCmd creates the cache command group
+func NewCacheCmd(log *logger.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect and maintain the tarball cache",
+		Long: `Inspect and maintain the tarball cache in ~/.zap/cache. Every downloaded
+version is kept there as <name>/<version>/package.tgz and reused by later
+downloads and installs.`,
+	}
+
+	cmd.AddCommand(
+		newCacheLsCmd(),
+		newCacheCleanCmd(),
+		newCacheVerifyCmd(log),
+		newCachePruneCmd(),
+		newCacheSizeCmd(),
+	)
+	return cmd
+}
+
+func newCacheLsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ls [pattern]",
+		Short: "List cached tarballs",
+		Long: `List cached tarballs, optionally only those whose name or name@version
+matches a glob pattern such as "react*" or "@babel/*".`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := downloader.ListCache(getCacheDir())
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			for _, entry := range entries {
+				if len(args) > 0 {
+					matched, err := matchEntry(args[0], entry)
+					if err != nil {
+						return err
+					}
+					if !matched {
+						continue
+					}
+				}
+				fmt.Fprintf(w, "%s@%s\t%s\t%s\n", entry.Name, entry.Version, formatSize(entry.Size), entry.ModTime.Format(time.DateTime))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newCacheCleanCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "clean [package[@version]]",
+		Short: "Remove cached tarballs",
+		Long: `Remove every cached version of a package, or only the exact version given.
+Without an argument the whole cache is emptied.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := downloader.ListCache(getCacheDir())
+			if err != nil {
+				return err
+			}
+
+			var name, version string
+			if len(args) > 0 {
+				name, version = parsePackageArg(args[0])
+			}
+
+			var selected []downloader.CacheEntry
+			for _, entry := range entries {
+				if (name == "" || entry.Name == name) && (version == "" || entry.Version == version) {
+					selected = append(selected, entry)
+				}
+			}
+			return removeEntries(cmd, selected)
+		},
+	}
+}
+
+func newCacheVerifyCmd(log *logger.Logger) *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify",
+		Short: "Hash every cached tarball and remove corrupt ones",
+		Long: `Hash every cached tarball and compare it with its checksum. Tarballs
+verified before are checked against the digest recorded then; others are
+looked up in the registry. Corrupt tarballs are reported and removed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := downloader.ListCache(getCacheDir())
+			if err != nil {
+				return err
+			}
+
+			// Only entries without a recorded digest need the registry
+			var registryClient *registry.RegistryClient
+			var corrupt []downloader.CacheEntry
+			verified, skipped := 0, 0
+			for _, entry := range entries {
+				dist := registry.Dist{Integrity: entry.Integrity}
+				if dist.Integrity == "" {
+					if registryClient == nil {
+						if registryClient, err = newRegistryClient(log); err != nil {
+							return err
+						}
+					}
+					info, err := registryClient.GetPackageVersion(cmd.Context(), entry.Name, entry.Version)
+					if err != nil {
+						if cmd.Context().Err() != nil {
+							return cmd.Context().Err()
+						}
+						log.Warnf("Skipping %s@%s: %v", entry.Name, entry.Version, err)
+						skipped++
+						continue
+					}
+					dist = info.Dist
+				}
+
+				ok, err := downloader.VerifyCacheEntry(entry, dist)
+				if err != nil {
+					log.Warnf("Skipping %s@%s: %v", entry.Name, entry.Version, err)
+					skipped++
+					continue
+				}
+				if !ok {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s@%s is corrupt\n", entry.Name, entry.Version)
+					corrupt = append(corrupt, entry)
+					continue
+				}
+				verified++
+			}
+
+			if err := removeEntries(cmd, corrupt); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Verified %d tarballs, %d corrupt, %d skipped\n", verified, len(corrupt), skipped)
+			return nil
+		},
+	}
+}
+
+func newCachePruneCmd() *cobra.Command {
+	var olderThan string
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove tarballs not used for a long time",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			age, err := parseAge(olderThan)
+			if err != nil {
+				return fmt.Errorf("invalid --older-than: %w", err)
+			}
+
+			entries, err := downloader.ListCache(getCacheDir())
+			if err != nil {
+				return err
+			}
+
+			cutoff := time.Now().Add(-age)
+			var selected []downloader.CacheEntry
+			for _, entry := range entries {
+				if entry.LastUsed.Before(cutoff) {
+					selected = append(selected, entry)
+				}
+			}
+			return removeEntries(cmd, selected)
+		},
+	}
+
+	cmd.Flags().StringVar(&olderThan, "older-than", "", "Remove tarballs not installed or downloaded for longer than this (e.g. 30d, 12h)")
+	cmd.MarkFlagRequired("older-than")
+	return cmd
+}
+
+func newCacheSizeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "size",
+		Short: "Show how much space cached tarballs take",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := downloader.ListCache(getCacheDir())
+			if err != nil {
+				return err
+			}
+
+			var total int64
+			for _, entry := range entries {
+				total += entry.Size
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%d tarballs, %s in %s\n", len(entries), formatSize(total), getCacheDir())
+			return nil
+		},
+	}
+}
+
+// removeEntries removes cache entries and reports what was freed
+func removeEntries(cmd *cobra.Command, entries []downloader.CacheEntry) error {
+	var freed int64
+	for _, entry := range entries {
+		if err := downloader.RemoveCacheEntry(cmd.Context(), getCacheDir(), entry); err != nil {
+			return err
+		}
+		freed += entry.Size
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Removed %d tarballs (%s)\n", len(entries), formatSize(freed))
+	return nil
+}
+
+// matchEntry reports whether a glob pattern matches the name or the
+// name@version of a cache entry
+func matchEntry(pattern string, entry downloader.CacheEntry) (bool, error) {
+	matched, err := path.Match(pattern, entry.Name)
+	if err != nil || matched {
+		return matched, err
+	}
+	return path.Match(pattern, entry.Name+"@"+entry.Version)
+}
+
+// parseAge parses a duration, additionally accepting whole days as "30d"
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// formatSize formats a byte count for humans
+func formatSize(bytes int64) string {
+	switch {
+	case bytes > 1024*1024*1024:
+		return fmt.Sprintf("%.2f GB", float64(bytes)/1024/1024/1024)
+	case bytes > 1024*1024:
+		return fmt.Sprintf("%.2f MB", float64(bytes)/1024/1024)
+	case bytes > 1024:
+		return fmt.Sprintf("%.2f KB", float64(bytes)/1024)
+	default:
+		return fmt.Sprintf("%d B", bytes)
+	}
+}
@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupCache fills a cache in a temporary home directory with one tarball
+// per entry, each recorded as verified with the digest of its content
+func setupCache(t *testing.T, entries map[string]string) string {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	for rel, content := range entries {
+		dir := filepath.Join(getCacheDir(), filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "package.tgz"), []byte(content), 0644))
+
+		sum := sha512.Sum512([]byte(content))
+		record := `{"integrity":"sha512-` + base64.StdEncoding.EncodeToString(sum[:]) + `"}`
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".package.verified.json"), []byte(record), 0644))
+	}
+	return getCacheDir()
+}
+
+// runCache runs a cache subcommand and returns its output
+func runCache(t *testing.T, args ...string) string {
+	t.Helper()
+	cmd := NewCacheCmd(logger.New())
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	cmd.SetArgs(args)
+	require.NoError(t, cmd.Execute())
+	return out.String()
+}
+
+func TestCacheLs(t *testing.T) {
+	setupCache(t, map[string]string{
+		"react/18.2.0":      "react",
+		"@babel/core/7.0.0": "core",
+		"@babel/core/7.1.0": "core",
+	})
+
+	out := runCache(t, "ls")
+	assert.Contains(t, out, "react@18.2.0")
+	assert.Contains(t, out, "@babel/core@7.0.0")
+
+	out = runCache(t, "ls", "@babel/*")
+	assert.NotContains(t, out, "react")
+	assert.Contains(t, out, "@babel/core@7.1.0")
+
+	out = runCache(t, "ls", "@babel/core@7.0.*")
+	assert.Contains(t, out, "@babel/core@7.0.0")
+	assert.NotContains(t, out, "7.1.0")
+}
+
+func TestCacheClean(t *testing.T) {
+	cacheDir := setupCache(t, map[string]string{
+		"react/18.2.0":      "react",
+		"@babel/core/7.0.0": "core",
+		"@babel/core/7.1.0": "core",
+	})
+
+	assert.Contains(t, runCache(t, "clean", "@babel/core@7.0.0"), "Removed 1 tarballs")
+	assert.NoDirExists(t, filepath.Join(cacheDir, "@babel", "core", "7.0.0"))
+	assert.DirExists(t, filepath.Join(cacheDir, "@babel", "core", "7.1.0"))
+
+	assert.Contains(t, runCache(t, "clean", "react"), "Removed 1 tarballs")
+	assert.NoDirExists(t, filepath.Join(cacheDir, "react"))
+
+	assert.Contains(t, runCache(t, "clean"), "Removed 1 tarballs")
+	assert.Contains(t, runCache(t, "size"), "0 tarballs")
+}
+
+func TestCacheVerify(t *testing.T) {
+	cacheDir := setupCache(t, map[string]string{
+		"react/18.2.0": "react",
+		"vue/3.0.0":    "vue",
+	})
+	require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "vue", "3.0.0", "package.tgz"), []byte("eve"), 0644))
+
+	out := runCache(t, "verify")
+	assert.Contains(t, out, "vue@3.0.0 is corrupt")
+	assert.Contains(t, out, "Verified 1 tarballs, 1 corrupt, 0 skipped")
+	assert.NoDirExists(t, filepath.Join(cacheDir, "vue"))
+	assert.FileExists(t, filepath.Join(cacheDir, "react", "18.2.0", "package.tgz"))
+}
+
+func TestCachePrune(t *testing.T) {
+	cacheDir := setupCache(t, map[string]string{
+		"react/18.2.0": "react",
+		"vue/3.0.0":    "vue",
+	})
+	old := time.Now().Add(-40 * 24 * time.Hour)
+	for _, dir := range []string{"react/18.2.0", "vue/3.0.0"} {
+		require.NoError(t, os.Chtimes(filepath.Join(cacheDir, dir, "package.tgz"), old, old))
+	}
+	require.NoError(t, os.Chtimes(filepath.Join(cacheDir, "vue", "3.0.0", ".package.verified.json"), old, old))
+
+	// react was downloaded as long ago as vue, but used since
+	assert.Contains(t, runCache(t, "prune", "--older-than", "30d"), "Removed 1 tarballs")
+	assert.NoDirExists(t, filepath.Join(cacheDir, "vue"))
+	assert.DirExists(t, filepath.Join(cacheDir, "react"))
+}
+
+func TestCacheSize(t *testing.T) {
+	setupCache(t, map[string]string{
+		"react/18.2.0": "react",
+		"vue/3.0.0":    "vue",
+	})
+	assert.Contains(t, runCache(t, "size"), "2 tarballs, 8 B")
+}
+
+func TestParseAge(t *testing.T) {
+	age, err := parseAge("30d")
+	require.NoError(t, err)
+	assert.Equal(t, 30*24*time.Hour, age)
+
+	age, err = parseAge("12h")
+	require.NoError(t, err)
+	assert.Equal(t, 12*time.Hour, age)
+
+	_, err = parseAge("xd")
+	assert.Error(t, err)
+}
+
+func TestVerifyExactVersionWithoutRegistry(t *testing.T) {
+	setupCache(t, map[string]string{"react/18.2.0": "react"})
+
+	// Any registry request would fail
+	t.Setenv("npm_config_registry", "http://127.0.0.1:1/")
+	t.Setenv("NPM_CONFIG_USERCONFIG", filepath.Join(t.TempDir(), "npmrc"))
+	t.Setenv("NPM_CONFIG_GLOBALCONFIG", filepath.Join(t.TempDir(), "npmrc"))
+
+	cmd := NewVerifyCmd(logger.New())
+	cmd.SetArgs([]string{"react@18.2.0"})
+	require.NoError(t, cmd.Execute())
+
+	cmd = NewVerifyCmd(logger.New())
+	cmd.SetArgs([]string{"--offline", "react@^18.0.0"})
+	cmd.SilenceUsage = true
+	assert.Error(t, cmd.Execute())
+}
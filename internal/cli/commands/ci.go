@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"github.com/marpit19/zap-pm/internal/installer"
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+// NewCiCmd creates a new ci command
+func NewCiCmd(log *logger.Logger) *cobra.Command {
+	var linker string
+	var network networkFlags
+
+	cmd := &cobra.Command{
+		Use:   "ci",
+		Short: "Clean install from zap-lock.json",
+		Long:  `Removes node_modules and installs exactly the versions recorded in zap-lock.json. Fails without touching the lock file if it is missing or out of sync with package.json`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runInstall(cmd.Context(), log, installer.Options{
+				UseCache:       true,
+				Concurrency:    3,
+				FrozenLockfile: true,
+				Clean:          true,
+				Linker:         linker,
+			}, network.mode())
+		},
+	}
+
+	cmd.Flags().StringVar(&linker, "linker", "", "node_modules layout: hoisted or isolated (default from package.json, else hoisted)")
+	network.register(cmd)
+	return cmd
+}
@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+// NewDistTagCmd creates the dist-tag command group
+func NewDistTagCmd(log *logger.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dist-tag",
+		Short: "Inspect package dist-tags",
+		Long: `Inspect the dist-tags of a package. Dist-tags such as latest, next or
+beta name release channels and can be used anywhere a version is accepted,
+for example "zap download react@next" or "next" in package.json.`,
+	}
+
+	cmd.AddCommand(newDistTagLsCmd(log))
+	return cmd
+}
+
+func newDistTagLsCmd(log *logger.Logger) *cobra.Command {
+	return &cobra.Command{
+		Use:   "ls [package]",
+		Short: "List the dist-tags of a package",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			packageName, _ := parsePackageArg(args[0])
+			registryClient, err := newRegistryClient(log)
+			if err != nil {
+				return err
+			}
+
+			tags, err := registryClient.GetDistTags(cmd.Context(), packageName)
+			if err != nil {
+				return fmt.Errorf("failed to fetch dist-tags: %w", err)
+			}
+
+			names := make([]string, 0, len(tags))
+			for name := range tags {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", name, tags[name])
+			}
+			return nil
+		},
+	}
+}
@@ -1,14 +1,19 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/marpit19/zap-pm/internal/auth"
 	"github.com/marpit19/zap-pm/internal/downloader"
 	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/marpit19/zap-pm/internal/npmrc"
 	"github.com/marpit19/zap-pm/internal/registry"
+	"github.com/marpit19/zap-pm/internal/semver"
 	"github.com/spf13/cobra"
 )
 
@@ -25,15 +30,15 @@ func NewDownloadCmd(log *logger.Logger) *cobra.Command {
 			packageName, version := parsePackageArg(args[0])
 
 			// Set up registry client
-			registryClient := registry.NewRegistryClient(log)
+			registryClient, err := newRegistryClient(log)
+			if err != nil {
+				return err
+			}
 
-			// If no version specified, get latest
-			if version == "" {
-				latestInfo, err := registryClient.GetLatestVersion(packageName)
-				if err != nil {
-					return fmt.Errorf("failed to get latest version: %w", err)
-				}
-				version = latestInfo.Version
+			// Resolve ranges and dist-tags, defaulting to latest
+			version, err = resolvePackageVersion(cmd.Context(), registryClient, packageName, version)
+			if err != nil {
+				return err
 			}
 
 			// Create cache directory
@@ -55,14 +60,14 @@ func NewDownloadCmd(log *logger.Logger) *cobra.Command {
 			// Download package
 			if withDependencies {
 				log.Infof("Downloading %s@%s with dependencies...", packageName, version)
-				results, err := dm.DownloadDependencies(packageName, version, opts)
+				results, err := dm.DownloadDependencies(cmd.Context(), packageName, version, opts)
 				if err != nil {
 					return fmt.Errorf("failed to download dependencies: %w", err)
 				}
 				log.Infof("Successfully downloaded %d packages", len(results))
 			} else {
 				log.Infof("Downloading %s@%s...", packageName, version)
-				result, err := dm.DownloadPackage(packageName, version, opts)
+				result, err := dm.DownloadPackage(cmd.Context(), packageName, version, opts)
 				if err != nil {
 					return fmt.Errorf("failed to download package: %w", err)
 				}
@@ -79,48 +84,181 @@ func NewDownloadCmd(log *logger.Logger) *cobra.Command {
 
 // NewVerifyCmd creates a new verify command
 func NewVerifyCmd(log *logger.Logger) *cobra.Command {
+	var deep, offline bool
+
 	cmd := &cobra.Command{
 		Use:   "verify [package[@version]]",
 		Short: "Verify package integrity in cache",
-		Args:  cobra.ExactArgs(1),
+		Long: `Verify a cached tarball against its published checksum. An exact version
+that was verified before is checked against the recorded digest without
+contacting the registry. Ranges and dist-tags are resolved from cached
+metadata when possible; with --offline the registry is never contacted.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			packageName, version := parsePackageArg(args[0])
 
-			registryClient := registry.NewRegistryClient(log)
+			registryClient, err := newRegistryClient(log)
+			if err != nil {
+				return err
+			}
+			// Verifying is a cache check: cached metadata is good enough
+			// however old it is
+			if offline {
+				registryClient.SetNetworkMode(registry.ModeOffline)
+			} else {
+				registryClient.SetNetworkMode(registry.ModePreferOffline)
+			}
 			dm := downloader.NewDownloadManager(registryClient, getCacheDir(), log)
 
+			if !isPinnedVersion(version) {
+				version, err = resolvePackageVersion(cmd.Context(), registryClient, packageName, version)
+				if err != nil {
+					return err
+				}
+			}
+
+			// A digest recorded when the tarball was verified before saves
+			// the metadata lookup
+			entry, err := downloader.FindCacheEntry(getCacheDir(), packageName, version)
+			if err != nil {
+				return err
+			}
+			var dist registry.Dist
+			if entry != nil && entry.Integrity != "" {
+				dist.Integrity = entry.Integrity
+			} else {
+				info, err := registryClient.GetPackageVersion(cmd.Context(), packageName, version)
+				if err != nil {
+					return fmt.Errorf("failed to verify package: %w", err)
+				}
+				dist = info.Dist
+			}
+
 			// Check if package exists in cache
-			opts := downloader.DownloadOptions{UseCache: true}
-			result, err := dm.DownloadPackage(packageName, version, opts)
+			opts := downloader.DownloadOptions{UseCache: true, Deep: deep, Offline: offline}
+			result, err := dm.DownloadDist(cmd.Context(), packageName, version, dist, opts)
 			if err != nil {
 				return fmt.Errorf("failed to verify package: %w", err)
 			}
 
 			log.Infof("Package %s@%s verified successfully", packageName, version)
 			log.Infof("Location: %s", result.Path)
-			log.Infof("Checksum: %s", result.Shasum)
+			log.Infof("Integrity (%s): %s", result.Algorithm, result.Integrity)
 
 			return nil
 		},
 	}
 
+	cmd.Flags().BoolVar(&deep, "deep", false, "Hash the cached tarball even if it was verified before")
+	cmd.Flags().BoolVar(&offline, "offline", false, "Never contact the registry; fail if the package or its metadata is not cached")
 	return cmd
 }
 
 // Helper functions
 
+const metadataMaxAgeEnv = "ZAP_METADATA_MAX_AGE"
+
+// resolvePackageVersion turns a version, range or dist-tag given on the
+// command line into an exact version. An empty version means latest.
+func resolvePackageVersion(ctx context.Context, registryClient *registry.RegistryClient, name, version string) (string, error) {
+	if version == "" {
+		version = "latest"
+	}
+
+	info, err := registryClient.GetPackageVersion(ctx, name, version)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s@%s: %w", name, version, err)
+	}
+	return info.Version, nil
+}
+
+// isPinnedVersion reports whether a version given on the command line names
+// one version in its canonical form, as opposed to a range or dist-tag.
+// Unlike the registry's exact version check, a leading v or surrounding
+// spaces do not count: the version is used as is to find the cache entry,
+// so anything else is resolved first.
+func isPinnedVersion(version string) bool {
+	v, err := semver.Parse(version)
+	return err == nil && v.String() == version
+}
+
+// parsePackageArg splits a name@version argument. The @ leading a scoped
+// name such as @babel/core@7.0.0 is part of the name.
 func parsePackageArg(arg string) (name, version string) {
-	parts := strings.Split(arg, "@")
-	if len(parts) > 1 {
-		return parts[0], parts[1]
+	at := strings.LastIndex(arg, "@")
+	if at <= 0 {
+		return arg, ""
+	}
+	return arg[:at], arg[at+1:]
+}
+
+// newRegistryClient creates a registry client that caches package metadata
+// under ~/.zap/metadata and talks to the registries configured in .npmrc,
+// with the credentials configured there. ZAP_METADATA_MAX_AGE (a duration
+// such as 10m) controls how long cached metadata is used before it is
+// revalidated.
+func newRegistryClient(log *logger.Logger) (*registry.RegistryClient, error) {
+	cfg, err := loadNpmrc(log)
+	if err != nil {
+		return nil, err
+	}
+
+	maxAge := registry.DefaultMetadataMaxAge
+	if value := os.Getenv(metadataMaxAgeEnv); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Warnf("Ignoring invalid %s %q: %v", metadataMaxAgeEnv, value, err)
+		} else {
+			maxAge = parsed
+		}
 	}
-	return parts[0], ""
+
+	client := registry.NewRegistryClient(log)
+	client.SetBaseURL(cfg.Registry())
+	client.SetAuth(auth.NewNpmrcProvider(cfg))
+	for scope, url := range cfg.ScopeRegistries() {
+		client.SetScopeRegistry(scope, url)
+	}
+	client.SetMetadataCache(getMetadataDir(), maxAge)
+	return client, nil
+}
+
+// loadNpmrc reads the .npmrc files that apply to the working directory
+func loadNpmrc(log *logger.Logger) (*npmrc.Config, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	cfg, err := npmrc.Load(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load npm configuration: %w", err)
+	}
+	for _, secret := range cfg.Secrets() {
+		log.AddSecret(secret)
+	}
+	for _, file := range cfg.Files() {
+		log.Debugf("Loaded npm configuration from %s", file)
+	}
+	return cfg, nil
 }
 
 func getCacheDir() string {
+	return filepath.Join(getZapDir(), "cache")
+}
+
+func getMetadataDir() string {
+	return filepath.Join(getZapDir(), "metadata")
+}
+
+func getStoreDir() string {
+	return filepath.Join(getZapDir(), "store")
+}
+
+func getZapDir() string {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		homeDir = "."
 	}
-	return filepath.Join(homeDir, ".zap", "cache")
+	return filepath.Join(homeDir, ".zap")
 }
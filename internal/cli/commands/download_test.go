@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePackageArg(t *testing.T) {
+	tests := []struct {
+		arg     string
+		name    string
+		version string
+	}{
+		{"express", "express", ""},
+		{"express@4.17.1", "express", "4.17.1"},
+		{"express@^4.0.0", "express", "^4.0.0"},
+		{"@babel/core", "@babel/core", ""},
+		{"@babel/core@7.0.0", "@babel/core", "7.0.0"},
+		{"@babel/core@next", "@babel/core", "next"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			name, version := parsePackageArg(tt.arg)
+			assert.Equal(t, tt.name, name)
+			assert.Equal(t, tt.version, version)
+		})
+	}
+}
+
+func TestIsPinnedVersion(t *testing.T) {
+	assert.True(t, isPinnedVersion("1.2.3"))
+	assert.True(t, isPinnedVersion("1.0.0-beta.1"))
+	assert.False(t, isPinnedVersion(""))
+	assert.False(t, isPinnedVersion("^1.2.3"))
+	assert.False(t, isPinnedVersion("1.2"))
+	assert.False(t, isPinnedVersion("latest"))
+	assert.False(t, isPinnedVersion("v1.2.3"))
+	assert.False(t, isPinnedVersion(" 1.2.3"))
+}
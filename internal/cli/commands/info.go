@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/marpit19/zap-pm/internal/logger"
-	"github.com/marpit19/zap-pm/internal/registry"
 	"github.com/spf13/cobra"
 )
 
@@ -16,16 +15,22 @@ func NewInfoCmd(log *logger.Logger) *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			packageName := args[0]
-			registryClient := registry.NewRegistryClient(log)
+			registryClient, err := newRegistryClient(log)
+			if err != nil {
+				return err
+			}
 
-			// Fetch package metadata
-			metadata, err := registryClient.GetPackageMetadata(packageName)
+			// Fetch the full document, which includes the description
+			metadata, err := registryClient.GetFullPackageMetadata(cmd.Context(), packageName)
 			if err != nil {
 				return fmt.Errorf("failed to fetch package info: %w", err)
 			}
 
 			// Display package information
 			fmt.Printf("Package: %s\n", metadata.Name)
+			if metadata.Description != "" {
+				fmt.Printf("Description: %s\n", metadata.Description)
+			}
 			fmt.Printf("Latest Version: %s\n", metadata.DistTags["latest"])
 
 			// Display versions
@@ -35,9 +40,9 @@ func NewInfoCmd(log *logger.Logger) *cobra.Command {
 			}
 
 			// Get latest version info
-			latest, err := registryClient.GetLatestVersion(packageName)
-			if err != nil {
-				return fmt.Errorf("failed to fetch latest version info: %w", err)
+			latest, ok := metadata.Versions[metadata.DistTags["latest"]]
+			if !ok {
+				return fmt.Errorf("failed to fetch latest version info: latest version not found for package %s", packageName)
 			}
 
 			// Display dependencies
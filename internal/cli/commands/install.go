@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/marpit19/zap-pm/internal/downloader"
+	"github.com/marpit19/zap-pm/internal/installer"
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/marpit19/zap-pm/internal/parser"
+	"github.com/marpit19/zap-pm/internal/registry"
+	"github.com/marpit19/zap-pm/internal/store"
+	"github.com/spf13/cobra"
+)
+
+// NewInstallCmd creates a new install command
+func NewInstallCmd(log *logger.Logger) *cobra.Command {
+	var frozenLockfile bool
+	var linker string
+	var network networkFlags
+
+	cmd := &cobra.Command{
+		Use:     "install",
+		Aliases: []string{"i"},
+		Short:   "Install all dependencies from package.json",
+		Long:    `Resolves the full transitive dependency graph of dependencies and devDependencies in package.json, downloads every package once and links them into ./node_modules from the global package store`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runInstall(cmd.Context(), log, installer.Options{
+				UseCache:       true,
+				Concurrency:    3,
+				FrozenLockfile: frozenLockfile,
+				Linker:         linker,
+			}, network.mode())
+		},
+	}
+
+	cmd.Flags().BoolVar(&frozenLockfile, "frozen-lockfile", false, "Fail instead of updating zap-lock.json when it is out of sync")
+	cmd.Flags().StringVar(&linker, "linker", "", "node_modules layout: hoisted or isolated (default from package.json, else hoisted)")
+	network.register(cmd)
+	return cmd
+}
+
+// runInstall installs the dependencies of the package.json in the working
+// directory
+func runInstall(ctx context.Context, log *logger.Logger, opts installer.Options, mode registry.NetworkMode) error {
+	pkg, err := parser.ParsePackageJSON("package.json")
+	if err != nil {
+		return err
+	}
+
+	registryClient, err := newRegistryClient(log)
+	if err != nil {
+		return err
+	}
+	registryClient.SetNetworkMode(mode)
+	opts.Offline = mode == registry.ModeOffline
+
+	// Create cache directory
+	cacheDir := getCacheDir()
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	dm := downloader.NewDownloadManager(registryClient, cacheDir, log)
+	inst := installer.New(registryClient, dm, store.New(getStoreDir(), log), log)
+
+	result, err := inst.Install(ctx, pkg, opts)
+	if err != nil {
+		return fmt.Errorf("install failed: %w", err)
+	}
+
+	log.Infof("Successfully installed %d packages", len(result.Downloads))
+	log.Infof("Package metadata: %s", registryClient.Stats())
+	return nil
+}
+
+// networkFlags are the flags selecting whether an install may use the
+// network
+type networkFlags struct {
+	offline       bool
+	preferOffline bool
+}
+
+func (f *networkFlags) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&f.offline, "offline", false, "Never contact the registry; fail if metadata or tarballs are missing from the cache")
+	cmd.Flags().BoolVar(&f.preferOffline, "prefer-offline", false, "Use cached metadata even when stale; only contact the registry for packages missing from the cache")
+	cmd.MarkFlagsMutuallyExclusive("offline", "prefer-offline")
+}
+
+func (f *networkFlags) mode() registry.NetworkMode {
+	switch {
+	case f.offline:
+		return registry.ModeOffline
+	case f.preferOffline:
+		return registry.ModePreferOffline
+	default:
+		return registry.ModeOnline
+	}
+}
@@ -29,6 +29,10 @@ func NewRootCommand(log *logger.Logger) *cobra.Command {
 		commands.NewInfoCmd(log),
 		commands.NewDownloadCmd(log),
 		commands.NewVerifyCmd(log),
+		commands.NewInstallCmd(log),
+		commands.NewCiCmd(log),
+		commands.NewDistTagCmd(log),
+		commands.NewCacheCmd(log),
 	)
 
 	return rootCmd
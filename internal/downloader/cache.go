@@ -0,0 +1,201 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marpit19/zap-pm/internal/filelock"
+	"github.com/marpit19/zap-pm/internal/registry"
+)
+
+// tarballName is the file holding a cached tarball. Entries are stored as
+// <name>/<version>/package.tgz, scoped names nesting one directory deeper.
+const tarballName = "package.tgz"
+
+// CacheEntry is a tarball in the cache
+type CacheEntry struct {
+	Name      string
+	Version   string
+	Path      string
+	Size      int64
+	ModTime   time.Time // when the tarball was downloaded
+	LastUsed  time.Time // when the tarball was last installed or downloaded
+	Integrity string    // SRI digest recorded when last verified, if any
+}
+
+// ListCache returns the tarballs in cacheDir sorted by name and version.
+// Lock files, partial downloads and verification records are not entries.
+func ListCache(cacheDir string) ([]CacheEntry, error) {
+	var entries []CacheEntry
+	err := filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == cacheDir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || d.Name() != tarballName {
+			return nil
+		}
+
+		rel, err := filepath.Rel(cacheDir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3) != strings.HasPrefix(parts[0], "@") {
+			// Not laid out by the download manager
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, newCacheEntry(strings.Join(parts[:len(parts)-1], "/"), parts[len(parts)-1], path, info))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].Version < entries[j].Version
+	})
+	return entries, nil
+}
+
+// FindCacheEntry returns the cached tarball of name@version, or nil when it
+// is not cached
+func FindCacheEntry(cacheDir, name, version string) (*CacheEntry, error) {
+	if err := registry.ValidatePackage(name, version); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(cacheDir, name, version, tarballName)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache: %w", err)
+	}
+	entry := newCacheEntry(name, version, path, info)
+	return &entry, nil
+}
+
+func newCacheEntry(name, version, path string, info os.FileInfo) CacheEntry {
+	entry := CacheEntry{
+		Name:     name,
+		Version:  version,
+		Path:     path,
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		LastUsed: info.ModTime(),
+	}
+	if record, err := readVerified(path); err == nil {
+		entry.Integrity = record.Integrity
+	}
+	if sidecar, err := os.Stat(verifiedPath(path)); err == nil && sidecar.ModTime().After(entry.LastUsed) {
+		entry.LastUsed = sidecar.ModTime()
+	}
+	return entry
+}
+
+// VerifyCacheEntry hashes a cached tarball against the checksum published
+// in dist. A match is recorded for later cache hits; a mismatch is
+// reported as false without removing anything. Verifying is not a use, so
+// the entry keeps its last used time.
+func VerifyCacheEntry(entry CacheEntry, dist registry.Dist) (bool, error) {
+	expected, err := expectedDigest(dist)
+	if err != nil {
+		return false, fmt.Errorf("cannot verify %s@%s: %w", entry.Name, entry.Version, err)
+	}
+	actual, err := hashFile(entry.Path, expected)
+	if err != nil {
+		return false, err
+	}
+	if !expected.matches(actual) {
+		return false, nil
+	}
+	recordVerified(entry.Path, expected)
+	os.Chtimes(verifiedPath(entry.Path), entry.LastUsed, entry.LastUsed)
+	return true, nil
+}
+
+// RemoveCacheEntry deletes a cached version, including any partial
+// download of it. A download of the version in progress is waited for.
+func RemoveCacheEntry(ctx context.Context, cacheDir string, entry CacheEntry) error {
+	dir := filepath.Dir(entry.Path)
+	lock, err := filelock.Acquire(ctx, filepath.Join(dir, lockName))
+	if err != nil {
+		return err
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		lock.Release()
+		return fmt.Errorf("failed to remove %s@%s: %w", entry.Name, entry.Version, err)
+	}
+	for _, file := range files {
+		if file.Name() == lockName {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, file.Name())); err != nil {
+			lock.Release()
+			return fmt.Errorf("failed to remove %s@%s: %w", entry.Name, entry.Version, err)
+		}
+	}
+	if err := lock.Release(); err != nil {
+		return err
+	}
+
+	// Drop the directories left empty, up to the cache itself. Removing
+	// a directory that is not empty fails, which ends the walk.
+	cacheDir = filepath.Clean(cacheDir)
+	for dir != cacheDir && strings.HasPrefix(dir, cacheDir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	return nil
+}
+
+// hashFile streams a file through the hash of the expected digest
+func hashFile(path string, expected *digest) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hash := expected.newHash()
+	if _, err := io.Copy(hash, f); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// readVerified reads the verification record of a cached tarball
+func readVerified(tarballPath string) (*verifiedRecord, error) {
+	data, err := os.ReadFile(verifiedPath(tarballPath))
+	if err != nil {
+		return nil, err
+	}
+	var record verifiedRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
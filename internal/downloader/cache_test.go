@@ -0,0 +1,134 @@
+package downloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/marpit19/zap-pm/internal/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCacheFile creates a file below cacheDir
+func writeCacheFile(t *testing.T, cacheDir, rel, content string) string {
+	t.Helper()
+	path := filepath.Join(cacheDir, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestListCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCacheFile(t, cacheDir, "react/18.2.0/package.tgz", "react")
+	writeCacheFile(t, cacheDir, "react/18.2.0/"+lockName, "")
+	writeCacheFile(t, cacheDir, "@babel/core/7.0.0/package.tgz", "babel")
+	writeCacheFile(t, cacheDir, "@babel/core/7.0.0/"+verifiedName, `{"integrity":"sha512-abc"}`)
+
+	// Partial downloads and stray files are not entries
+	writeCacheFile(t, cacheDir, "lodash/4.17.21/"+partialName, "lod")
+	writeCacheFile(t, cacheDir, "package.tgz", "stray")
+	writeCacheFile(t, cacheDir, "a/b/c/d/package.tgz", "too deep")
+
+	entries, err := ListCache(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "@babel/core", entries[0].Name)
+	assert.Equal(t, "7.0.0", entries[0].Version)
+	assert.Equal(t, "sha512-abc", entries[0].Integrity)
+	assert.Equal(t, "react", entries[1].Name)
+	assert.Equal(t, int64(len("react")), entries[1].Size)
+	assert.Empty(t, entries[1].Integrity)
+
+	// A cache that was never created is empty
+	entries, err = ListCache(filepath.Join(cacheDir, "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRemoveCacheEntry(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCacheFile(t, cacheDir, "@babel/core/7.0.0/package.tgz", "babel")
+	writeCacheFile(t, cacheDir, "@babel/core/7.0.0/"+verifiedName, "{}")
+	writeCacheFile(t, cacheDir, "@babel/parser/7.0.0/package.tgz", "parser")
+
+	entries, err := ListCache(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// Empty directories go up to the scope, which still holds parser
+	require.NoError(t, RemoveCacheEntry(context.Background(), cacheDir, entries[0]))
+	assert.NoDirExists(t, filepath.Join(cacheDir, "@babel", "core"))
+	assert.DirExists(t, filepath.Join(cacheDir, "@babel", "parser", "7.0.0"))
+
+	require.NoError(t, RemoveCacheEntry(context.Background(), cacheDir, entries[1]))
+	assert.NoDirExists(t, filepath.Join(cacheDir, "@babel"))
+	assert.DirExists(t, cacheDir)
+}
+
+func TestVerifyCacheEntry(t *testing.T) {
+	mock := createMockFile("pkg-1.0.0-content")
+	cacheDir := t.TempDir()
+	writeCacheFile(t, cacheDir, "pkg/1.0.0/package.tgz", mock.Content)
+	writeCacheFile(t, cacheDir, "bad/1.0.0/package.tgz", "corrupted")
+
+	entries, err := ListCache(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	bad, good := entries[0], entries[1]
+
+	ok, err := VerifyCacheEntry(good, registry.Dist{Integrity: mock.Integrity})
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// The match is recorded for the next listing
+	entries, err = ListCache(cacheDir)
+	require.NoError(t, err)
+	assert.Equal(t, mock.Integrity, entries[1].Integrity)
+
+	ok, err = VerifyCacheEntry(bad, registry.Dist{Integrity: mock.Integrity})
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.FileExists(t, bad.Path)
+}
+
+func TestCacheHitUpdatesLastUsed(t *testing.T) {
+	mock := createMockFile("pkg-1.0.0-content")
+	cacheDir := t.TempDir()
+	path := writeCacheFile(t, cacheDir, "pkg/1.0.0/package.tgz", mock.Content)
+	old := time.Now().Add(-40 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(path, old, old))
+
+	dm := NewDownloadManager(registry.NewRegistryClient(logger.New()), cacheDir, logger.New())
+	expected, err := expectedDigest(registry.Dist{Integrity: mock.Integrity})
+	require.NoError(t, err)
+	_, _, err = dm.checkCache("pkg", "1.0.0", expected, false)
+	require.NoError(t, err)
+	require.NoError(t, os.Chtimes(verifiedPath(path), old, old))
+
+	entry, err := FindCacheEntry(cacheDir, "pkg", "1.0.0")
+	require.NoError(t, err)
+	assert.WithinDuration(t, old, entry.LastUsed, time.Second)
+
+	// Verifying the entry does not count as using it
+	ok, err := VerifyCacheEntry(*entry, registry.Dist{Integrity: mock.Integrity})
+	require.NoError(t, err)
+	require.True(t, ok)
+	entry, err = FindCacheEntry(cacheDir, "pkg", "1.0.0")
+	require.NoError(t, err)
+	assert.WithinDuration(t, old, entry.LastUsed, time.Second)
+
+	// A hit trusting the sidecar does
+	_, exists, err := dm.checkCache("pkg", "1.0.0", expected, false)
+	require.NoError(t, err)
+	require.True(t, exists)
+	entry, err = FindCacheEntry(cacheDir, "pkg", "1.0.0")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), entry.LastUsed, time.Minute)
+	assert.Equal(t, old.Unix(), entry.ModTime.Unix())
+}
@@ -0,0 +1,120 @@
+package downloader
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/marpit19/zap-pm/internal/registry"
+)
+
+// integrityAlgorithm is a hash function usable in Subresource Integrity
+type integrityAlgorithm struct {
+	strength int
+	newHash  func() hash.Hash
+}
+
+var integrityAlgorithms = map[string]integrityAlgorithm{
+	"sha1":   {strength: 1, newHash: sha1.New},
+	"sha256": {strength: 2, newHash: sha256.New},
+	"sha384": {strength: 3, newHash: sha512.New384},
+	"sha512": {strength: 4, newHash: sha512.New},
+}
+
+// digest is the expected hash of a tarball
+type digest struct {
+	Algorithm string
+	sum       []byte
+	legacy    bool // taken from the hex encoded dist.shasum
+}
+
+// expectedDigest picks the strongest checksum published for dist. The SRI
+// dist.integrity field is preferred; dist.shasum is only used when no
+// integrity is published, so a garbled integrity cannot downgrade
+// verification to SHA-1.
+func expectedDigest(dist registry.Dist) (*digest, error) {
+	if dist.Integrity != "" {
+		return parseIntegrity(dist.Integrity)
+	}
+
+	if dist.Shasum == "" {
+		return nil, fmt.Errorf("no integrity or shasum available")
+	}
+	sum, err := hex.DecodeString(dist.Shasum)
+	if err != nil || len(sum) != sha1.Size {
+		return nil, fmt.Errorf("invalid shasum %q", dist.Shasum)
+	}
+	return &digest{Algorithm: "sha1", sum: sum, legacy: true}, nil
+}
+
+// parseIntegrity selects the strongest supported hash from an SRI string
+// such as "sha512-<base64> sha1-<base64>". Unknown algorithms are skipped
+// as the spec requires, but a malformed hash of a supported algorithm is
+// an error rather than silently ignored.
+func parseIntegrity(integrity string) (*digest, error) {
+	var best *digest
+	bestStrength := 0
+
+	for _, token := range strings.Fields(integrity) {
+		// Options after '?' are reserved by the spec and ignored
+		token, _, _ = strings.Cut(token, "?")
+		name, encoded, ok := strings.Cut(token, "-")
+		if !ok {
+			return nil, fmt.Errorf("malformed integrity %q", integrity)
+		}
+
+		algorithm, supported := integrityAlgorithms[name]
+		if !supported {
+			continue
+		}
+
+		sum, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(sum) != algorithm.newHash().Size() {
+			return nil, fmt.Errorf("malformed %s hash in integrity %q", name, integrity)
+		}
+
+		if algorithm.strength > bestStrength {
+			best = &digest{Algorithm: name, sum: sum}
+			bestStrength = algorithm.strength
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("unsupported integrity %q", integrity)
+	}
+	return best, nil
+}
+
+// newHash returns a fresh hash matching the digest's algorithm
+func (d *digest) newHash() hash.Hash {
+	return integrityAlgorithms[d.Algorithm].newHash()
+}
+
+// matches reports whether sum equals the expected digest
+func (d *digest) matches(sum []byte) bool {
+	return subtle.ConstantTimeCompare(d.sum, sum) == 1
+}
+
+// format encodes a raw sum the way the expected digest was published
+func (d *digest) format(sum []byte) string {
+	if d.legacy {
+		return hex.EncodeToString(sum)
+	}
+	return d.Algorithm + "-" + base64.StdEncoding.EncodeToString(sum)
+}
+
+// String returns the expected digest in its published encoding
+func (d *digest) String() string {
+	return d.format(d.sum)
+}
+
+// Integrity returns the expected digest as an SRI string
+func (d *digest) Integrity() string {
+	return d.Algorithm + "-" + base64.StdEncoding.EncodeToString(d.sum)
+}
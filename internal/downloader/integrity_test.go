@@ -0,0 +1,106 @@
+package downloader
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/marpit19/zap-pm/internal/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectedDigest(t *testing.T) {
+	content := []byte("tarball-content")
+	sha1Sum := sha1.Sum(content)
+	sha256Sum := sha256.Sum256(content)
+	sha512Sum := sha512.Sum512(content)
+
+	shasum := hex.EncodeToString(sha1Sum[:])
+	sri256 := "sha256-" + base64.StdEncoding.EncodeToString(sha256Sum[:])
+	sri512 := "sha512-" + base64.StdEncoding.EncodeToString(sha512Sum[:])
+
+	tests := []struct {
+		name          string
+		dist          registry.Dist
+		wantAlgorithm string
+		wantString    string
+		wantErr       bool
+	}{
+		{
+			name:          "integrity preferred over shasum",
+			dist:          registry.Dist{Shasum: shasum, Integrity: sri512},
+			wantAlgorithm: "sha512",
+			wantString:    sri512,
+		},
+		{
+			name:          "strongest of several hashes",
+			dist:          registry.Dist{Integrity: sri256 + " " + sri512 + "?opt sha1-" + base64.StdEncoding.EncodeToString(sha1Sum[:])},
+			wantAlgorithm: "sha512",
+			wantString:    sri512,
+		},
+		{
+			name:          "unknown algorithms are skipped",
+			dist:          registry.Dist{Integrity: "md5-AAAA " + sri256},
+			wantAlgorithm: "sha256",
+			wantString:    sri256,
+		},
+		{
+			name:          "legacy shasum fallback",
+			dist:          registry.Dist{Shasum: shasum},
+			wantAlgorithm: "sha1",
+			wantString:    shasum,
+		},
+		{
+			name:    "malformed integrity does not fall back to shasum",
+			dist:    registry.Dist{Shasum: shasum, Integrity: "sha512-not*base64"},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported integrity does not fall back to shasum",
+			dist:    registry.Dist{Shasum: shasum, Integrity: "md5-AAAA"},
+			wantErr: true,
+		},
+		{
+			name:    "malformed hash next to a valid one",
+			dist:    registry.Dist{Integrity: "sha512-AAAA " + sri256},
+			wantErr: true,
+		},
+		{
+			name:    "integrity without algorithm",
+			dist:    registry.Dist{Integrity: "garbage"},
+			wantErr: true,
+		},
+		{
+			name:    "unusable integrity without shasum",
+			dist:    registry.Dist{Integrity: "md5-AAAA"},
+			wantErr: true,
+		},
+		{
+			name:    "nothing to verify against",
+			dist:    registry.Dist{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := expectedDigest(tt.dist)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAlgorithm, d.Algorithm)
+			assert.Equal(t, tt.wantString, d.String())
+
+			h := d.newHash()
+			h.Write(content)
+			assert.True(t, d.matches(h.Sum(nil)))
+			assert.False(t, d.matches([]byte("other")))
+		})
+	}
+}
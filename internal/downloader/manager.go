@@ -1,9 +1,9 @@
 package downloader
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
+	"context"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"os"
@@ -11,6 +11,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/marpit19/zap-pm/internal/auth"
+	"github.com/marpit19/zap-pm/internal/filelock"
+	"github.com/marpit19/zap-pm/internal/fsutil"
 	"github.com/marpit19/zap-pm/internal/logger"
 	"github.com/marpit19/zap-pm/internal/registry"
 )
@@ -19,6 +22,9 @@ const (
 	defaultConcurrency = 3
 	defaultTimeout     = 30 * time.Second
 	defaultBufferSize  = 32 * 1024 // 32KB buffer
+
+	// lockName is the lock file guarding a cache entry
+	lockName = ".package.lock"
 )
 
 // DownloadOptions configures the download behavior
@@ -27,6 +33,8 @@ type DownloadOptions struct {
 	UseCache     bool
 	ShowProgress bool
 	Timeout      time.Duration
+	Offline      bool // serve tarballs from the cache only, never download
+	Deep         bool // hash cached tarballs even if verified before
 }
 
 // DownloadResult contains information about a completed download
@@ -35,6 +43,8 @@ type DownloadResult struct {
 	Version     string
 	Path        string
 	Shasum      string
+	Integrity   string // SRI string of the verified digest
+	Algorithm   string // hash algorithm used for verification
 	Error       error
 }
 
@@ -48,9 +58,10 @@ type DownloadManager struct {
 	mu          sync.Mutex
 }
 
-// NewDownloadManager creates a new download manager
+// NewDownloadManager creates a new download manager, authenticating
+// downloads like the registry client does
 func NewDownloadManager(registryClient *registry.RegistryClient, cacheDir string, log *logger.Logger) *DownloadManager {
-	return &DownloadManager{
+	dm := &DownloadManager{
 		client: &http.Client{
 			Timeout: defaultTimeout,
 		},
@@ -58,57 +69,109 @@ func NewDownloadManager(registryClient *registry.RegistryClient, cacheDir string
 		cacheDir: cacheDir,
 		log:      log,
 	}
+
+	// Tarballs are usually served by the registry and need its credentials
+	if provider := registryClient.Auth(); provider != nil {
+		dm.SetAuth(provider)
+	}
+	return dm
+}
+
+// SetAuth authenticates tarball downloads with provider
+func (dm *DownloadManager) SetAuth(provider auth.Provider) {
+	auth.Wrap(dm.client, provider)
 }
 
 // DownloadPackage downloads a single package
-func (dm *DownloadManager) DownloadPackage(name, version string, opts DownloadOptions) (*DownloadResult, error) {
+func (dm *DownloadManager) DownloadPackage(ctx context.Context, name, version string, opts DownloadOptions) (*DownloadResult, error) {
 	dm.log.Infof("Downloading package %s@%s", name, version)
 
 	// Get package metadata
-	versionInfo, err := dm.registry.GetPackageVersion(name, version)
+	versionInfo, err := dm.registry.GetPackageVersion(ctx, name, version)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get package metadata: %w", err)
 	}
 
-	// Check cache first if enabled
-	if opts.UseCache {
-		if cachedPath, exists, err := dm.checkCache(name, version, versionInfo.Dist.Shasum); err != nil {
+	return dm.DownloadDist(ctx, name, versionInfo.Version, versionInfo.Dist, opts)
+}
+
+// DownloadDist downloads a package whose version and dist information are
+// already resolved, skipping the registry metadata lookup
+func (dm *DownloadManager) DownloadDist(ctx context.Context, name, version string, dist registry.Dist, opts DownloadOptions) (*DownloadResult, error) {
+	// Both name the cache directory of the tarball
+	if err := registry.ValidatePackage(name, version); err != nil {
+		return nil, err
+	}
+
+	expected, err := expectedDigest(dist)
+	if err != nil {
+		return nil, fmt.Errorf("cannot verify %s@%s: %w", name, version, err)
+	}
+
+	result := &DownloadResult{
+		PackageName: name,
+		Version:     version,
+		Shasum:      dist.Shasum,
+		Integrity:   expected.Integrity(),
+		Algorithm:   expected.Algorithm,
+	}
+
+	// Check cache first if enabled. Offline downloads can only be served
+	// from the cache.
+	if opts.UseCache || opts.Offline {
+		if cachedPath, exists, err := dm.checkCache(name, version, expected, opts.Deep); err != nil {
 			// Propagate checksum mismatch error
 			return nil, fmt.Errorf("cache validation failed: %w", err)
 		} else if exists {
 			dm.log.Infof("Using cached version from: %s", cachedPath)
-			return &DownloadResult{
-				PackageName: name,
-				Version:     version,
-				Path:        cachedPath,
-				Shasum:      versionInfo.Dist.Shasum,
-			}, nil
+			result.Path = cachedPath
+			return result, nil
 		}
 	}
 
+	if opts.Offline {
+		return nil, fmt.Errorf("%s@%s is not in the tarball cache and the network is disabled (offline mode)", name, version)
+	}
+
 	// Cache miss or disabled, download the package
 	targetDir := filepath.Join(dm.cacheDir, name, version)
-	targetPath := filepath.Join(targetDir, "package.tgz")
+	targetPath := filepath.Join(targetDir, tarballName)
+
+	// Other processes share the cache. Whoever holds the entry's lock
+	// downloads it, everyone else waits and then reuses the result.
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create target directory: %w", err)
+	}
+	lock, err := filelock.Acquire(ctx, filepath.Join(targetDir, lockName))
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	if opts.UseCache {
+		if cachedPath, exists, err := dm.checkCache(name, version, expected, opts.Deep); err == nil && exists {
+			dm.log.Infof("Using version downloaded while waiting: %s", cachedPath)
+			result.Path = cachedPath
+			return result, nil
+		}
+	}
 
 	// Download the package
-	if err := dm.downloadFile(versionInfo.Dist.Tarball, targetPath, versionInfo.Dist.Shasum, opts.ShowProgress); err != nil {
+	if err := dm.downloadFile(ctx, dist.Tarball, targetPath, expected, opts.ShowProgress); err != nil {
 		return nil, err
 	}
+	recordVerified(targetPath, expected)
 
-	return &DownloadResult{
-		PackageName: name,
-		Version:     version,
-		Path:        targetPath,
-		Shasum:      versionInfo.Dist.Shasum,
-	}, nil
+	result.Path = targetPath
+	return result, nil
 }
 
 // DownloadDependencies downloads all dependencies for a package
-func (dm *DownloadManager) DownloadDependencies(name, version string, opts DownloadOptions) ([]*DownloadResult, error) {
+func (dm *DownloadManager) DownloadDependencies(ctx context.Context, name, version string, opts DownloadOptions) ([]*DownloadResult, error) {
 	dm.log.Infof("Downloading dependencies for %s@%s", name, version)
 
 	// Get package metadata
-	versionInfo, err := dm.registry.GetPackageVersion(name, version)
+	versionInfo, err := dm.registry.GetPackageVersion(ctx, name, version)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get package metadata: %w", err)
 	}
@@ -140,12 +203,17 @@ func (dm *DownloadManager) DownloadDependencies(name, version string, opts Downl
 		go func(name, version string) {
 			defer wg.Done()
 
-			// Acquire semaphore
-			semaphore <- struct{}{}
+			// Acquire semaphore, unless the downloads were canceled
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				errorsChan <- fmt.Errorf("failed to download %s@%s: %w", name, version, ctx.Err())
+				return
+			}
 			defer func() { <-semaphore }()
 
 			dm.log.Debugf("Downloading dependency: %s@%s", name, version)
-			result, err := dm.DownloadPackage(name, version, opts)
+			result, err := dm.DownloadPackage(ctx, name, version, opts)
 			if err != nil {
 				errorsChan <- fmt.Errorf("failed to download %s@%s: %w", name, version, err)
 				return
@@ -178,8 +246,13 @@ func (dm *DownloadManager) DownloadDependencies(name, version string, opts Downl
 	return results, nil
 }
 
-// downloadFile downloads a file and verifies its checksum
-func (dm *DownloadManager) downloadFile(url, targetPath, expectedShasum string, showProgress bool) error {
+// downloadFile downloads a file and verifies its checksum. The download is
+// written to a partial file next to the target, which is synced to disk
+// and renamed into place only once its checksum matches, so the target
+// never holds a partial or corrupt tarball. Dropped connections are
+// resumed with Range requests; the partial file is kept across runs until
+// the download succeeds, and removed when it is canceled or corrupt.
+func (dm *DownloadManager) downloadFile(ctx context.Context, url, targetPath string, expected *digest, showProgress bool) error {
 	dm.log.Debugf("Downloading from URL: %s", url)
 	dm.log.Debugf("Target path: %s", targetPath)
 
@@ -188,99 +261,221 @@ func (dm *DownloadManager) downloadFile(url, targetPath, expectedShasum string,
 		return fmt.Errorf("failed to create target directory: %w", err)
 	}
 
-	// Create the target file
-	out, err := os.Create(targetPath)
-	if err != nil {
-		return fmt.Errorf("failed to create target file: %w", err)
+	partial := newPartialDownload(url, targetPath)
+	for attempt := 1; ; attempt++ {
+		resumable, err := dm.transfer(ctx, partial, targetPath, expected, showProgress)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			partial.remove()
+			return err
+		}
+		if !resumable || attempt > maxResumeAttempts {
+			return err
+		}
+
+		dm.log.Warnf("Download of %s failed, resuming (attempt %d): %v", url, attempt+1, err)
+		select {
+		case <-time.After(resumeDelay):
+		case <-ctx.Done():
+			partial.remove()
+			return ctx.Err()
+		}
+	}
+}
+
+// transfer continues a partial download from where it stopped, or starts
+// it over, and moves it to targetPath once complete and verified. It
+// reports whether a failed transfer is worth resuming.
+func (dm *DownloadManager) transfer(ctx context.Context, partial *partialDownload, targetPath string, expected *digest, showProgress bool) (bool, error) {
+	// Hash what an earlier attempt left behind
+	hash := expected.newHash()
+	state := partial.state()
+	var offset int64
+	if state != nil {
+		offset = hashPartial(partial.path, hash)
+	}
+	if offset == 0 {
+		hash.Reset()
 	}
-	defer out.Close()
 
 	// Create request
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", partial.url, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return false, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Add relevant headers
 	req.Header.Set("Accept", "application/octet-stream")
 	req.Header.Set("User-Agent", "zap-package-manager/0.1.0")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator := state.validator(); validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+	}
 
 	// Get the file
 	resp, err := dm.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to download file: %w", err)
+		return true, fmt.Errorf("failed to download file: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download file (status %d): %s", resp.StatusCode, resp.Status)
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, err := contentRangeStart(resp.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			partial.remove()
+			return true, fmt.Errorf("server resumed at an unexpected position: %s", resp.Header.Get("Content-Range"))
+		}
+		dm.log.Debugf("Resuming download at byte %d", offset)
+	case http.StatusOK:
+		// The server ignores ranges or the content changed since the
+		// partial download began
+		if offset > 0 {
+			dm.log.Debugf("Server sent the whole file, discarding %d downloaded bytes", offset)
+			offset = 0
+			hash.Reset()
+		}
+		if err := partial.start(resp.Header); err != nil {
+			return false, fmt.Errorf("failed to record partial download: %w", err)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		partial.remove()
+		return true, fmt.Errorf("server rejected resuming at byte %d", offset)
+	default:
+		// Server errors may pass, so bytes already downloaded are kept for
+		// the next attempt. Anything else will not succeed on retry.
+		err := fmt.Errorf("failed to download file (status %d): %s", resp.StatusCode, resp.Status)
+		if resp.StatusCode >= 500 {
+			return true, err
+		}
+		partial.remove()
+		return false, err
+	}
+
+	// The partial file is only created once the server delivers content
+	out, err := os.OpenFile(partial.path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return false, fmt.Errorf("failed to create target file: %w", err)
+	}
+	defer out.Close()
+	if offset == 0 {
+		err = out.Truncate(0)
+	} else {
+		_, err = out.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to prepare partial download: %w", err)
 	}
 
 	// Setup progress bar if requested
 	var reader io.Reader = resp.Body
 	if showProgress {
+		total := resp.ContentLength
+		if total >= 0 {
+			total += offset
+		}
 		dm.mu.Lock()
-		dm.progressBar = NewProgressBar(resp.ContentLength)
+		dm.progressBar = NewProgressBar(total)
+		dm.progressBar.Add(offset)
 		dm.mu.Unlock()
 		reader = dm.progressBar.NewProxyReader(resp.Body)
 	}
 
-	// Setup checksum calculation
-	hash := sha1.New()
-	writer := io.MultiWriter(out, hash)
-
 	// Copy the data
-	written, err := io.Copy(writer, reader)
+	written, err := io.Copy(io.MultiWriter(out, hash), reader)
 	if err != nil {
-		os.Remove(targetPath)
-		return fmt.Errorf("download interrupted: %w", err)
+		out.Sync()
+		return true, fmt.Errorf("download interrupted after %d bytes: %w", offset+written, err)
 	}
 
 	dm.log.Debugf("Downloaded %d bytes", written)
 
-	// Verify checksum
-	actualShasum := hex.EncodeToString(hash.Sum(nil))
-	if actualShasum != expectedShasum {
-		os.Remove(targetPath)
-		return fmt.Errorf("checksum mismatch (expected: %s, got: %s)", expectedShasum, actualShasum)
+	if err := out.Sync(); err != nil {
+		return false, fmt.Errorf("failed to write target file: %w", err)
 	}
 
-	dm.log.Debugf("Checksum verified: %s", actualShasum)
-	return nil
+	// Verify checksum. A resumed download may have been stitched from
+	// different content, so it is tried once more from scratch.
+	actual := hash.Sum(nil)
+	if !expected.matches(actual) {
+		partial.remove()
+		return offset > 0, fmt.Errorf("checksum mismatch (expected: %s, got: %s)", expected, expected.format(actual))
+	}
+	dm.log.Debugf("Checksum verified (%s): %s", expected.Algorithm, expected)
+
+	if err := out.Close(); err != nil {
+		return false, fmt.Errorf("failed to write target file: %w", err)
+	}
+	if err := os.Rename(partial.path, targetPath); err != nil {
+		return false, fmt.Errorf("failed to move download into place: %w", err)
+	}
+	os.Remove(partial.statePath)
+
+	// Make the rename durable, so a crash cannot leave an empty tarball
+	if err := fsutil.SyncDir(filepath.Dir(targetPath)); err != nil {
+		return false, err
+	}
+	return false, nil
 }
 
-// checkCache looks for a package in the cache
-func (dm *DownloadManager) checkCache(name, version, expectedShasum string) (string, bool, error) {
-	path := filepath.Join(dm.cacheDir, name, version, "package.tgz")
+// hashPartial feeds the bytes of a partial download into hash and returns
+// how many there are, or 0 when there is nothing usable
+func hashPartial(path string, h hash.Hash) int64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// checkCache looks for a package in the cache. The tarball is hashed as
+// it is read, unless its sidecar records it as verified and deep checks
+// are not requested.
+func (dm *DownloadManager) checkCache(name, version string, expected *digest, deep bool) (string, bool, error) {
+	path := filepath.Join(dm.cacheDir, name, version, tarballName)
 	dm.log.Debugf("Checking cache for %s@%s at %s", name, version, path)
 
 	// Check if file exists
-	if _, err := os.Stat(path); err != nil {
+	info, err := os.Stat(path)
+	if err != nil {
 		dm.log.Debugf("Cache miss: file not found")
 		return "", false, nil
 	}
 
-	// Read the entire file
-	content, err := os.ReadFile(path)
+	if !deep && isVerified(path, info, expected) {
+		dm.log.Debug("Cache hit: verified before and unchanged since")
+		touchVerified(path)
+		return path, true, nil
+	}
+
+	// Calculate checksum
+	actual, err := hashFile(path, expected)
 	if err != nil {
 		dm.log.Debugf("Cache miss: failed to read file: %v", err)
 		return "", false, nil
 	}
 
-	// Calculate checksum
-	hash := sha1.New()
-	hash.Write(content)
-	actualShasum := hex.EncodeToString(hash.Sum(nil))
-
-	dm.log.Debugf("Cache checksum comparison - Expected: %s, Got: %s", expectedShasum, actualShasum)
+	dm.log.Debugf("Cache checksum comparison (%s) - Expected: %s, Got: %s", expected.Algorithm, expected, expected.format(actual))
 
-	if actualShasum != expectedShasum {
+	if !expected.matches(actual) {
 		dm.log.Warn("Cache miss: checksum mismatch")
 		// Remove invalid cache entry
 		os.Remove(path)
-		return "", false, fmt.Errorf("checksum mismatch in cached file (expected: %s, got: %s)", expectedShasum, actualShasum)
+		os.Remove(verifiedPath(path))
+		return "", false, fmt.Errorf("checksum mismatch in cached file (expected: %s, got: %s)", expected, expected.format(actual))
 	}
 
 	dm.log.Debug("Cache hit: checksums match")
+	recordVerified(path, expected)
 	return path, true, nil
 }
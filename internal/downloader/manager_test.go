@@ -1,7 +1,10 @@
 package downloader
 
 import (
+	"context"
 	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"net/http"
@@ -9,6 +12,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -27,19 +32,23 @@ type MockTestServer struct {
 
 // MockFile represents a test package file
 type MockFile struct {
-	Name    string
-	Content string
-	Shasum  string
+	Name      string
+	Content   string
+	Shasum    string
+	Integrity string
 }
 
 // createMockFile creates a mock package file and returns its SHA1 hash
+// and SHA-512 integrity
 func createMockFile(content string) MockFile {
 	hash := sha1.New()
 	hash.Write([]byte(content))
+	sum := sha512.Sum512([]byte(content))
 	return MockFile{
-		Name:    "package.tgz",
-		Content: content,
-		Shasum:  hex.EncodeToString(hash.Sum(nil)),
+		Name:      "package.tgz",
+		Content:   content,
+		Shasum:    hex.EncodeToString(hash.Sum(nil)),
+		Integrity: "sha512-" + base64.StdEncoding.EncodeToString(sum[:]),
 	}
 }
 
@@ -50,6 +59,7 @@ func setupMockServer() *MockTestServer {
 		"express-4.17.1":     createMockFile("express-4.17.1-content"),
 		"body-parser-1.19.0": createMockFile("body-parser-1.19.0-content"),
 		"cookie-0.4.0":       createMockFile("cookie-0.4.0-content"),
+		"tampered-1.0.0":     createMockFile("tampered-1.0.0-content"),
 	}
 
 	mockServer := &MockTestServer{
@@ -140,14 +150,15 @@ func (ms *MockTestServer) createPackageMetadata(packageName string) string {
 					"dependencies": {},
 					"dist": {
 						"tarball": "%s/body-parser/-/1.19.0.tgz",
-						"shasum": "%s"
+						"shasum": "%s",
+						"integrity": "%s"
 					}
 				}
 			},
 			"dist-tags": {
 				"latest": "1.19.0"
 			}
-		}`, ms.BaseURL, ms.MockFiles["body-parser-1.19.0"].Shasum)
+		}`, ms.BaseURL, ms.MockFiles["body-parser-1.19.0"].Shasum, ms.MockFiles["body-parser-1.19.0"].Integrity)
 
 	case "cookie":
 		return fmt.Sprintf(`{
@@ -166,6 +177,25 @@ func (ms *MockTestServer) createPackageMetadata(packageName string) string {
 				"latest": "0.4.0"
 			}
 		}`, ms.BaseURL, ms.MockFiles["cookie-0.4.0"].Shasum)
+
+	case "tampered":
+		// The shasum matches the served content, the integrity does not
+		return fmt.Sprintf(`{
+			"name": "tampered",
+			"versions": {
+				"1.0.0": {
+					"version": "1.0.0",
+					"dist": {
+						"tarball": "%s/tampered/-/1.0.0.tgz",
+						"shasum": "%s",
+						"integrity": "%s"
+					}
+				}
+			},
+			"dist-tags": {
+				"latest": "1.0.0"
+			}
+		}`, ms.BaseURL, ms.MockFiles["tampered-1.0.0"].Shasum, ms.MockFiles["cookie-0.4.0"].Integrity)
 	}
 
 	return ""
@@ -202,7 +232,7 @@ func TestDownloadPackage(t *testing.T) {
 	}
 
 	// Test successful download
-	result, err := dm.DownloadPackage("express", "4.17.1", opts)
+	result, err := dm.DownloadPackage(context.Background(), "express", "4.17.1", opts)
 	require.NoError(t, err)
 	require.NotNil(t, result)
 
@@ -213,7 +243,7 @@ func TestDownloadPackage(t *testing.T) {
 	assert.Equal(t, "express-4.17.1-content", string(content))
 
 	// Test nonexistent package
-	_, err = dm.DownloadPackage("nonexistent", "1.0.0", opts)
+	_, err = dm.DownloadPackage(context.Background(), "nonexistent", "1.0.0", opts)
 	assert.Error(t, err)
 }
 
@@ -228,7 +258,7 @@ func TestDownloadDependencies(t *testing.T) {
 		ShowProgress: true,
 	}
 
-	results, err := dm.DownloadDependencies("express", "4.17.1", opts)
+	results, err := dm.DownloadDependencies(context.Background(), "express", "4.17.1", opts)
 	require.NoError(t, err)
 	assert.Len(t, results, 2) // body-parser and cookie
 
@@ -252,13 +282,13 @@ func TestCacheHandling(t *testing.T) {
 
 	// First download
 	start := time.Now()
-	result1, err := dm.DownloadPackage("express", "4.17.1", opts)
+	result1, err := dm.DownloadPackage(context.Background(), "express", "4.17.1", opts)
 	require.NoError(t, err)
 	firstDownloadTime := time.Since(start)
 
 	// Second download (should use cache)
 	start = time.Now()
-	result2, err := dm.DownloadPackage("express", "4.17.1", opts)
+	result2, err := dm.DownloadPackage(context.Background(), "express", "4.17.1", opts)
 	require.NoError(t, err)
 	cachedDownloadTime := time.Since(start)
 
@@ -267,13 +297,35 @@ func TestCacheHandling(t *testing.T) {
 	assert.True(t, cachedDownloadTime < firstDownloadTime)
 }
 
+func TestOfflineDownloads(t *testing.T) {
+	mockServer, _, dm, tempDir := setupTestServer()
+	defer mockServer.Server.Close()
+	defer os.RemoveAll(tempDir)
+
+	_, err := dm.DownloadPackage(context.Background(), "express", "4.17.1", DownloadOptions{UseCache: true})
+	require.NoError(t, err)
+
+	opts := DownloadOptions{Offline: true}
+
+	// Cached tarballs are served without the network
+	result, err := dm.DownloadPackage(context.Background(), "express", "4.17.1", opts)
+	require.NoError(t, err)
+	assert.FileExists(t, result.Path)
+
+	// Missing tarballs fail instead of being downloaded
+	_, err = dm.DownloadPackage(context.Background(), "body-parser", "1.19.0", opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "offline mode")
+	assert.NoFileExists(t, filepath.Join(tempDir, "body-parser", "1.19.0", "package.tgz"))
+}
+
 func TestChecksumVerification(t *testing.T) {
 	mockServer, _, dm, tempDir := setupTestServer()
 	defer mockServer.Server.Close()
 	defer os.RemoveAll(tempDir)
 
 	// 1. First download - this should succeed
-	result, err := dm.DownloadPackage("express", "4.17.1", DownloadOptions{UseCache: false})
+	result, err := dm.DownloadPackage(context.Background(), "express", "4.17.1", DownloadOptions{UseCache: false})
 	require.NoError(t, err)
 	require.NotNil(t, result)
 
@@ -296,7 +348,7 @@ func TestChecksumVerification(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// 4. Try to download again with cache enabled - this should detect the mismatch
-	_, err = dm.DownloadPackage("express", "4.17.1", DownloadOptions{UseCache: true})
+	_, err = dm.DownloadPackage(context.Background(), "express", "4.17.1", DownloadOptions{UseCache: true})
 	require.Error(t, err, "Expected error due to checksum mismatch")
 	assert.Contains(t, err.Error(), "checksum mismatch", "Error should mention checksum mismatch")
 
@@ -305,7 +357,7 @@ func TestChecksumVerification(t *testing.T) {
 	assert.True(t, os.IsNotExist(err), "Tampered file should have been removed")
 
 	// 6. Final download should succeed by fetching fresh copy
-	finalResult, err := dm.DownloadPackage("express", "4.17.1", DownloadOptions{UseCache: true})
+	finalResult, err := dm.DownloadPackage(context.Background(), "express", "4.17.1", DownloadOptions{UseCache: true})
 	require.NoError(t, err)
 	require.NotNil(t, finalResult)
 
@@ -316,12 +368,43 @@ func TestChecksumVerification(t *testing.T) {
 	assert.Equal(t, originalShasum, finalResult.Shasum)
 
 	// 8. Verify we can now use the cache successfully
-	cachedResult, err := dm.DownloadPackage("express", "4.17.1", DownloadOptions{UseCache: true})
+	cachedResult, err := dm.DownloadPackage(context.Background(), "express", "4.17.1", DownloadOptions{UseCache: true})
 	require.NoError(t, err)
 	require.NotNil(t, cachedResult)
 	assert.Equal(t, finalResult.Path, cachedResult.Path)
 }
 
+func TestIntegrityVerification(t *testing.T) {
+	mockServer, _, dm, tempDir := setupTestServer()
+	defer mockServer.Server.Close()
+	defer os.RemoveAll(tempDir)
+
+	opts := DownloadOptions{UseCache: true}
+
+	// Packages publishing dist.integrity are verified with it
+	result, err := dm.DownloadPackage(context.Background(), "body-parser", "1.19.0", opts)
+	require.NoError(t, err)
+	assert.Equal(t, "sha512", result.Algorithm)
+	assert.Equal(t, mockServer.MockFiles["body-parser-1.19.0"].Integrity, result.Integrity)
+
+	// The cache hit is verified with the same algorithm
+	cached, err := dm.DownloadPackage(context.Background(), "body-parser", "1.19.0", opts)
+	require.NoError(t, err)
+	assert.Equal(t, "sha512", cached.Algorithm)
+
+	// Packages without integrity fall back to the legacy shasum
+	result, err = dm.DownloadPackage(context.Background(), "cookie", "0.4.0", opts)
+	require.NoError(t, err)
+	assert.Equal(t, "sha1", result.Algorithm)
+	assert.Equal(t, mockServer.MockFiles["cookie-0.4.0"].Shasum, result.Shasum)
+
+	// A matching shasum does not rescue a mismatching integrity
+	_, err = dm.DownloadPackage(context.Background(), "tampered", "1.0.0", opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum mismatch")
+	assert.Contains(t, err.Error(), "sha512-")
+}
+
 func cleanup(t *testing.T, paths ...string) {
 	for _, path := range paths {
 		if path != "" {
@@ -346,3 +429,360 @@ func TestMain(m *testing.M) {
 
 	os.Exit(code)
 }
+
+func TestCanceledDownloadRemovesPartialFile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	content := strings.Repeat("x", 64*1024)
+	mock := createMockFile(content)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		w.Write([]byte(content[:1024]))
+		w.(http.Flusher).Flush()
+
+		// Cancel halfway through the body and hold the rest back
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	dm := NewDownloadManager(registry.NewRegistryClient(logger.New()), cacheDir, logger.New())
+	dist := registry.Dist{Tarball: server.URL + "/pkg/-/pkg-1.0.0.tgz", Integrity: mock.Integrity}
+
+	_, err := dm.DownloadDist(ctx, "pkg", "1.0.0", dist, DownloadOptions{})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assertNoPartialFiles(t, filepath.Join(cacheDir, "pkg", "1.0.0"))
+}
+
+// assertNoPartialFiles checks that dir holds no package.tgz and no
+// temporary download
+func assertNoPartialFiles(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		t.Errorf("unexpected file %s left in %s", entry.Name(), dir)
+	}
+}
+
+func TestFailedDownloadKeepsCachedTarball(t *testing.T) {
+	mock := createMockFile("pkg-1.0.0-content")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("corrupted by a proxy"))
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	targetPath := filepath.Join(cacheDir, "pkg", "1.0.0", "package.tgz")
+	require.NoError(t, os.MkdirAll(filepath.Dir(targetPath), 0755))
+	require.NoError(t, os.WriteFile(targetPath, []byte(mock.Content), 0644))
+
+	dm := NewDownloadManager(registry.NewRegistryClient(logger.New()), cacheDir, logger.New())
+	dist := registry.Dist{Tarball: server.URL + "/pkg/-/pkg-1.0.0.tgz", Integrity: mock.Integrity}
+
+	_, err := dm.DownloadDist(context.Background(), "pkg", "1.0.0", dist, DownloadOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum mismatch")
+
+	// The verified tarball is untouched and no temporary file is left
+	content, err := os.ReadFile(targetPath)
+	require.NoError(t, err)
+	assert.Equal(t, mock.Content, string(content))
+	entries, err := os.ReadDir(filepath.Dir(targetPath))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// A successful download replaces it atomically
+	result, err := dm.DownloadDist(context.Background(), "pkg", "1.0.0", registry.Dist{
+		Tarball:   server.URL + "/pkg/-/pkg-1.0.0.tgz",
+		Integrity: createMockFile("corrupted by a proxy").Integrity,
+	}, DownloadOptions{})
+	require.NoError(t, err)
+	info, err := os.Stat(result.Path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
+
+func TestDownloadDependenciesCanceled(t *testing.T) {
+	mockServer, _, dm, tempDir := setupTestServer()
+	defer mockServer.Server.Close()
+	defer os.RemoveAll(tempDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := dm.DownloadDependencies(ctx, "express", "4.17.1", DownloadOptions{})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NoDirExists(t, filepath.Join(tempDir, "body-parser"))
+}
+
+func TestConcurrentManagersShareDownloads(t *testing.T) {
+	mock := createMockFile("shared-1.0.0-content")
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(mock.Content))
+	}))
+	defer server.Close()
+
+	// Separate managers stand in for separate zap processes
+	cacheDir := t.TempDir()
+	dist := registry.Dist{Tarball: server.URL + "/shared/-/shared-1.0.0.tgz", Integrity: mock.Integrity}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dm := NewDownloadManager(registry.NewRegistryClient(logger.New()), cacheDir, logger.New())
+			result, err := dm.DownloadDist(context.Background(), "shared", "1.0.0", dist, DownloadOptions{UseCache: true})
+			if assert.NoError(t, err) {
+				assert.FileExists(t, result.Path)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(1), requests.Load())
+	assert.NoFileExists(t, filepath.Join(cacheDir, "shared", "1.0.0", lockName))
+}
+
+// flakyServer serves content with Range support, dropping the connection
+// after half of the body for the first drops responses
+type flakyServer struct {
+	*httptest.Server
+	content     string
+	drops       int
+	ignoreRange bool
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func newFlakyServer(content string, drops int) *flakyServer {
+	fs := &flakyServer{content: content, drops: drops}
+	fs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fs.mu.Lock()
+		fs.ranges = append(fs.ranges, r.Header.Get("Range"))
+		drop := fs.drops > 0
+		fs.drops--
+		fs.mu.Unlock()
+
+		w.Header().Set("ETag", `"v1"`)
+		body := fs.content
+		var start int
+		if rng := r.Header.Get("Range"); rng != "" && !fs.ignoreRange && r.Header.Get("If-Range") == `"v1"` {
+			fmt.Sscanf(rng, "bytes=%d-", &start)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(body)-1, len(body)))
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)-start))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		}
+
+		body = body[start:]
+		if drop {
+			// Declared but never sent, the client sees the connection drop
+			body = body[:len(body)/2]
+		}
+		w.Write([]byte(body))
+	}))
+	return fs
+}
+
+func (fs *flakyServer) requestedRanges() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]string(nil), fs.ranges...)
+}
+
+func TestResumeInterruptedDownload(t *testing.T) {
+	defer func(delay time.Duration) { resumeDelay = delay }(resumeDelay)
+	resumeDelay = 0
+
+	content := strings.Repeat("0123456789", 1000)
+	mock := createMockFile(content)
+	server := newFlakyServer(content, 1)
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	dm := NewDownloadManager(registry.NewRegistryClient(logger.New()), cacheDir, logger.New())
+	dist := registry.Dist{Tarball: server.URL + "/pkg/-/pkg-1.0.0.tgz", Integrity: mock.Integrity}
+
+	result, err := dm.DownloadDist(context.Background(), "pkg", "1.0.0", dist, DownloadOptions{})
+	require.NoError(t, err)
+
+	downloaded, err := os.ReadFile(result.Path)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(downloaded))
+	assert.Equal(t, []string{"", "bytes=5000-"}, server.requestedRanges())
+
+	// The partial download is gone
+	assert.NoFileExists(t, filepath.Join(filepath.Dir(result.Path), partialName))
+	assert.NoFileExists(t, filepath.Join(filepath.Dir(result.Path), partialName+".json"))
+}
+
+func TestResumeWithoutRangeSupport(t *testing.T) {
+	defer func(delay time.Duration) { resumeDelay = delay }(resumeDelay)
+	resumeDelay = 0
+
+	content := strings.Repeat("0123456789", 1000)
+	mock := createMockFile(content)
+	server := newFlakyServer(content, 1)
+	server.ignoreRange = true
+	defer server.Close()
+
+	dm := NewDownloadManager(registry.NewRegistryClient(logger.New()), t.TempDir(), logger.New())
+	dist := registry.Dist{Tarball: server.URL + "/pkg/-/pkg-1.0.0.tgz", Integrity: mock.Integrity}
+
+	// The whole file sent again replaces the partial one
+	result, err := dm.DownloadDist(context.Background(), "pkg", "1.0.0", dist, DownloadOptions{})
+	require.NoError(t, err)
+	downloaded, err := os.ReadFile(result.Path)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(downloaded))
+	assert.Len(t, server.requestedRanges(), 2)
+}
+
+func TestPartialDownloadKeptAcrossRuns(t *testing.T) {
+	defer func(delay time.Duration) { resumeDelay = delay }(resumeDelay)
+	resumeDelay = 0
+
+	content := strings.Repeat("0123456789", 1000)
+	mock := createMockFile(content)
+	server := newFlakyServer(content, maxResumeAttempts+1)
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	dm := NewDownloadManager(registry.NewRegistryClient(logger.New()), cacheDir, logger.New())
+	dist := registry.Dist{Tarball: server.URL + "/pkg/-/pkg-1.0.0.tgz", Integrity: mock.Integrity}
+
+	_, err := dm.DownloadDist(context.Background(), "pkg", "1.0.0", dist, DownloadOptions{})
+	require.Error(t, err)
+	assert.Len(t, server.requestedRanges(), maxResumeAttempts+1)
+
+	// Each attempt got half of what was left
+	partial, err := os.ReadFile(filepath.Join(cacheDir, "pkg", "1.0.0", partialName))
+	require.NoError(t, err)
+	assert.Greater(t, len(partial), len(content)/2)
+	assert.Equal(t, content[:len(partial)], string(partial))
+
+	// The next run picks up where the last one stopped
+	result, err := dm.DownloadDist(context.Background(), "pkg", "1.0.0", dist, DownloadOptions{})
+	require.NoError(t, err)
+	ranges := server.requestedRanges()
+	assert.Equal(t, fmt.Sprintf("bytes=%d-", len(partial)), ranges[len(ranges)-1])
+
+	downloaded, err := os.ReadFile(result.Path)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(downloaded))
+}
+
+func TestCacheHitSkipsVerifiedTarball(t *testing.T) {
+	mock := createMockFile("pkg-1.0.0-content")
+	cacheDir := t.TempDir()
+	path := filepath.Join(cacheDir, "pkg", "1.0.0", "package.tgz")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(mock.Content), 0644))
+
+	dm := NewDownloadManager(registry.NewRegistryClient(logger.New()), cacheDir, logger.New())
+	expected, err := expectedDigest(registry.Dist{Integrity: mock.Integrity})
+	require.NoError(t, err)
+
+	// The first hit hashes the tarball and records it
+	_, exists, err := dm.checkCache("pkg", "1.0.0", expected, false)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.FileExists(t, verifiedPath(path))
+
+	// Corrupt the tarball behind the sidecar's back, keeping size and
+	// modification time: only a deep check notices
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(strings.ToUpper(mock.Content)), 0644))
+	require.NoError(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+
+	_, exists, err = dm.checkCache("pkg", "1.0.0", expected, false)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	_, exists, err = dm.checkCache("pkg", "1.0.0", expected, true)
+	require.Error(t, err)
+	assert.False(t, exists)
+	assert.NoFileExists(t, path)
+	assert.NoFileExists(t, verifiedPath(path))
+}
+
+func TestModifiedTarballIsHashedAgain(t *testing.T) {
+	mock := createMockFile("pkg-1.0.0-content")
+	cacheDir := t.TempDir()
+	path := filepath.Join(cacheDir, "pkg", "1.0.0", "package.tgz")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(mock.Content), 0644))
+
+	dm := NewDownloadManager(registry.NewRegistryClient(logger.New()), cacheDir, logger.New())
+	expected, err := expectedDigest(registry.Dist{Integrity: mock.Integrity})
+	require.NoError(t, err)
+
+	_, _, err = dm.checkCache("pkg", "1.0.0", expected, false)
+	require.NoError(t, err)
+
+	// A changed modification time invalidates the sidecar
+	require.NoError(t, os.WriteFile(path, []byte("tampered-content!"), 0644))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+
+	_, exists, err := dm.checkCache("pkg", "1.0.0", expected, false)
+	require.Error(t, err)
+	assert.False(t, exists)
+}
+
+func TestFailedStatusLeavesNoPartialDownload(t *testing.T) {
+	defer func(delay time.Duration) { resumeDelay = delay }(resumeDelay)
+	resumeDelay = 0
+
+	for _, status := range []int{http.StatusNotFound, http.StatusServiceUnavailable} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Empty(t, r.Header.Get("Range"))
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			mock := createMockFile("pkg-1.0.0-content")
+			cacheDir := t.TempDir()
+			dm := NewDownloadManager(registry.NewRegistryClient(logger.New()), cacheDir, logger.New())
+			dist := registry.Dist{Tarball: server.URL + "/pkg/-/pkg-1.0.0.tgz", Integrity: mock.Integrity}
+
+			_, err := dm.DownloadDist(context.Background(), "pkg", "1.0.0", dist, DownloadOptions{})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), fmt.Sprint(status))
+			assertNoPartialFiles(t, filepath.Join(cacheDir, "pkg", "1.0.0"))
+		})
+	}
+}
+
+func TestClientErrorDiscardsPartialDownload(t *testing.T) {
+	mock := createMockFile("pkg-1.0.0-content")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	url := server.URL + "/pkg/-/pkg-1.0.0.tgz"
+	partial := newPartialDownload(url, filepath.Join(cacheDir, "pkg", "1.0.0", "package.tgz"))
+	require.NoError(t, os.MkdirAll(filepath.Dir(partial.path), 0755))
+	require.NoError(t, os.WriteFile(partial.path, []byte("pkg-1.0"), 0644))
+	require.NoError(t, partial.start(http.Header{}))
+
+	dm := NewDownloadManager(registry.NewRegistryClient(logger.New()), cacheDir, logger.New())
+	_, err := dm.DownloadDist(context.Background(), "pkg", "1.0.0", registry.Dist{Tarball: url, Integrity: mock.Integrity}, DownloadOptions{})
+	require.Error(t, err)
+	assertNoPartialFiles(t, filepath.Dir(partial.path))
+}
@@ -0,0 +1,100 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// partialName holds the bytes of an interrupted download
+	partialName = ".package.tgz.partial"
+
+	// maxResumeAttempts bounds how often one download is resumed after
+	// the connection dropped
+	maxResumeAttempts = 5
+)
+
+// resumeDelay is the pause before resuming an interrupted download
+var resumeDelay = 500 * time.Millisecond
+
+// partialState records what a partial download belongs to, so it is only
+// resumed against the same URL and, through If-Range, the same content
+type partialState struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// validator returns the If-Range value identifying the partial content, or
+// an empty string when the server sent no strong validator
+func (s *partialState) validator() string {
+	if s.ETag != "" && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
+	}
+	return s.LastModified
+}
+
+// partialDownload is a download kept next to its target while in progress
+type partialDownload struct {
+	url       string
+	path      string
+	statePath string
+}
+
+func newPartialDownload(url, targetPath string) *partialDownload {
+	path := filepath.Join(filepath.Dir(targetPath), partialName)
+	return &partialDownload{url: url, path: path, statePath: path + ".json"}
+}
+
+// state returns the recorded state if it belongs to the same URL, or nil
+func (p *partialDownload) state() *partialState {
+	data, err := os.ReadFile(p.statePath)
+	if err != nil {
+		return nil
+	}
+	var state partialState
+	if err := json.Unmarshal(data, &state); err != nil || state.URL != p.url {
+		return nil
+	}
+	return &state
+}
+
+// start records the validators of a response delivering the download from
+// its first byte
+func (p *partialDownload) start(header http.Header) error {
+	data, err := json.Marshal(partialState{
+		URL:          p.url,
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p.statePath, data, 0644)
+}
+
+// remove discards the partial download
+func (p *partialDownload) remove() {
+	os.Remove(p.path)
+	os.Remove(p.statePath)
+}
+
+// contentRangeStart returns the first byte position of a Content-Range
+// header such as "bytes 100-199/200"
+func contentRangeStart(header string) (int64, error) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, fmt.Errorf("unsupported Content-Range %q", header)
+	}
+	start, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, fmt.Errorf("invalid Content-Range %q", header)
+	}
+	return strconv.ParseInt(start, 10, 64)
+}
@@ -0,0 +1,63 @@
+package downloader
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// verifiedName is the sidecar recording that a cached tarball was verified.
+// Its own modification time records when the tarball was last used.
+const verifiedName = ".package.verified.json"
+
+// verifiedRecord describes a cached tarball as it was when its checksum
+// last matched. While the file keeps its size and modification time, it is
+// trusted without hashing it again.
+type verifiedRecord struct {
+	Integrity string `json:"integrity"`
+	Size      int64  `json:"size"`
+	ModTime   int64  `json:"mtime"` // nanoseconds since the Unix epoch
+}
+
+// verifiedPath returns the sidecar path of a cached tarball
+func verifiedPath(tarballPath string) string {
+	return filepath.Join(filepath.Dir(tarballPath), verifiedName)
+}
+
+// isVerified reports whether the sidecar vouches for the tarball described
+// by info having the expected digest
+func isVerified(tarballPath string, info os.FileInfo, expected *digest) bool {
+	record, err := readVerified(tarballPath)
+	if err != nil {
+		return false
+	}
+	return record.Integrity == expected.Integrity() &&
+		record.Size == info.Size() &&
+		record.ModTime == info.ModTime().UnixNano()
+}
+
+// recordVerified writes the sidecar for a tarball whose checksum matched.
+// The sidecar is only an optimization, so failing to write it is not an
+// error.
+func recordVerified(tarballPath string, expected *digest) {
+	info, err := os.Stat(tarballPath)
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(verifiedRecord{
+		Integrity: expected.Integrity(),
+		Size:      info.Size(),
+		ModTime:   info.ModTime().UnixNano(),
+	})
+	if err != nil {
+		return
+	}
+	os.WriteFile(verifiedPath(tarballPath), data, 0644)
+}
+
+// touchVerified records that a cached tarball was just used
+func touchVerified(tarballPath string) {
+	now := time.Now()
+	os.Chtimes(verifiedPath(tarballPath), now, now)
+}
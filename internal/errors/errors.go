@@ -24,6 +24,12 @@ func (e *ZapError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Type, e.Message)
 }
 
+// Unwrap returns the underlying error, so errors.Is and errors.As see
+// through ZapError
+func (e *ZapError) Unwrap() error {
+	return e.Err
+}
+
 // New creates a new ZapError
 func New(errType string, message string, err error) *ZapError {
 	return &ZapError{
@@ -0,0 +1,307 @@
+package extractor
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	dirMode        = 0755
+	fileMode       = 0644
+	executableMode = 0755
+
+	maxSymlinkDepth = 40
+)
+
+// Entry is a single validated entry of an npm tarball
+type Entry struct {
+	Path     string      // slash separated, relative to the package root
+	Type     byte        // tar.TypeDir, tar.TypeReg, tar.TypeSymlink or tar.TypeLink
+	Mode     os.FileMode // normalized permissions of regular files
+	Linkname string      // symlink target, or package relative path of a hardlink source
+	Reader   io.Reader   // content of regular files, valid during the callback only
+}
+
+// Walk reads the gzipped npm tarball from r and calls fn for every entry.
+// The leading directory npm wraps every package in ("package/") is
+// stripped, and entries that would resolve outside of the package root,
+// directly or through a symlink, are rejected. Symlinks are reported last,
+// once the whole archive has been validated.
+func Walk(r io.Reader, fn func(*Entry) error) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("invalid gzip stream: %w", err)
+	}
+	defer gz.Close()
+
+	var paths []string
+	symlinks := make(map[string]string)
+	files := make(map[string]bool)
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar stream: %w", err)
+		}
+
+		rel, ok, err := entryPath(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		entry := &Entry{Path: rel, Type: hdr.Typeflag}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			entry.Mode = dirMode
+
+		case tar.TypeReg:
+			entry.Mode = fileMode
+			if hdr.FileInfo().Mode()&0111 != 0 {
+				entry.Mode = executableMode
+			}
+			entry.Reader = tr
+			files[rel] = true
+
+		case tar.TypeSymlink:
+			if hdr.Linkname == "" || path.IsAbs(filepath.ToSlash(hdr.Linkname)) {
+				return fmt.Errorf("unsafe symlink in tarball: %s -> %s", rel, hdr.Linkname)
+			}
+			// Symlinks are created after everything else, so no entry can
+			// be written through one
+			symlinks[rel] = filepath.ToSlash(hdr.Linkname)
+			paths = append(paths, rel)
+			continue
+
+		case tar.TypeLink:
+			source, ok, err := entryPath(hdr.Linkname)
+			if err != nil || !ok || !files[source] {
+				return fmt.Errorf("unsafe hardlink in tarball: %s -> %s", rel, hdr.Linkname)
+			}
+			entry.Linkname = source
+			files[rel] = true
+
+		default:
+			// Device nodes, fifos and other exotic entries have no place in
+			// a JavaScript package
+			continue
+		}
+
+		paths = append(paths, rel)
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return emitSymlinks(paths, symlinks, fn)
+}
+
+// emitSymlinks validates the final set of symlinks and reports them
+func emitSymlinks(paths []string, symlinks map[string]string, fn func(*Entry) error) error {
+	if len(symlinks) == 0 {
+		return nil
+	}
+
+	for _, p := range paths {
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			if _, ok := symlinks[dir]; ok {
+				return fmt.Errorf("unsafe path in tarball: %s is written through a symlink", p)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(symlinks))
+	for name := range symlinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		target := symlinks[name]
+		if _, ok := resolveInside(symlinks, path.Dir(name)+"/"+target, 0); !ok {
+			return fmt.Errorf("unsafe symlink in tarball: %s -> %s", name, target)
+		}
+		if err := fn(&Entry{Path: name, Type: tar.TypeSymlink, Linkname: target}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveInside resolves p one component at a time, following the
+// archive's symlinks, and reports whether it stays inside the package root
+func resolveInside(symlinks map[string]string, p string, depth int) (string, bool) {
+	if depth > maxSymlinkDepth {
+		return "", false
+	}
+
+	var resolved []string
+	for _, part := range strings.Split(p, "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return "", false
+			}
+			resolved = resolved[:len(resolved)-1]
+		default:
+			resolved = append(resolved, part)
+			target, ok := symlinks[strings.Join(resolved, "/")]
+			if !ok {
+				continue
+			}
+			base := strings.Join(resolved[:len(resolved)-1], "/")
+			next, ok := resolveInside(symlinks, base+"/"+target, depth+1)
+			if !ok {
+				return "", false
+			}
+			resolved = nil
+			if next != "" {
+				resolved = strings.Split(next, "/")
+			}
+		}
+	}
+	return strings.Join(resolved, "/"), true
+}
+
+// entryPath strips the top level directory from a tarball entry name and
+// rejects names escaping the package root. It reports false for the top
+// level directory itself.
+func entryPath(name string) (string, bool, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if path.IsAbs(name) {
+		return "", false, fmt.Errorf("unsafe path in tarball: %s", name)
+	}
+
+	name = strings.TrimPrefix(name, "./")
+	idx := strings.Index(name, "/")
+	if idx < 0 || idx == len(name)-1 {
+		return "", false, nil
+	}
+
+	rel := path.Clean(name[idx+1:])
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false, fmt.Errorf("unsafe path in tarball: %s", name)
+	}
+	if rel == "." {
+		return "", false, nil
+	}
+	return rel, true, nil
+}
+
+// Extract unpacks the gzipped npm tarball at src into dest
+func Extract(src, dest string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer f.Close()
+
+	if err := ExtractReader(f, dest); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", src, err)
+	}
+	return nil
+}
+
+// ExtractReader unpacks a gzipped npm tarball read from r into dest. On
+// failure dest is removed, so a rejected archive leaves nothing behind.
+func ExtractReader(r io.Reader, dest string) error {
+	if err := os.MkdirAll(dest, dirMode); err != nil {
+		return fmt.Errorf("failed to create destination: %w", err)
+	}
+
+	err := Walk(r, func(entry *Entry) error {
+		target := filepath.Join(dest, filepath.FromSlash(entry.Path))
+
+		switch entry.Type {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, dirMode); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", entry.Path, err)
+			}
+
+		case tar.TypeReg:
+			if err := writeFile(target, entry.Reader, entry.Mode); err != nil {
+				return fmt.Errorf("failed to write %s: %w", entry.Path, err)
+			}
+
+		case tar.TypeLink:
+			source := filepath.Join(dest, filepath.FromSlash(entry.Linkname))
+			if err := prepare(target); err != nil {
+				return err
+			}
+			if err := os.Link(source, target); err != nil {
+				return fmt.Errorf("failed to create hardlink %s: %w", entry.Path, err)
+			}
+
+		case tar.TypeSymlink:
+			if err := prepare(target); err != nil {
+				return err
+			}
+			if err := os.Symlink(filepath.FromSlash(entry.Linkname), target); err != nil {
+				return fmt.Errorf("failed to create symlink %s: %w", entry.Path, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		os.RemoveAll(dest)
+		return err
+	}
+	return nil
+}
+
+// writeFile writes a regular file with the given permissions
+func writeFile(target string, r io.Reader, perm os.FileMode) error {
+	if err := prepare(target); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	// The umask may have stripped bits from the requested permissions
+	return os.Chmod(target, perm)
+}
+
+// prepare creates the parent directory of target and removes a previous
+// entry at target, so duplicate archive entries replace each other
+func prepare(target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), dirMode); err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("cannot replace directory %s with a file", target)
+	}
+	return os.Remove(target)
+}
@@ -0,0 +1,211 @@
+package extractor
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// entry describes a single tar entry used to build test archives
+type entry struct {
+	name     string
+	body     string
+	mode     int64
+	typeflag byte
+	linkname string
+}
+
+func buildArchive(t *testing.T, entries ...entry) *bytes.Buffer {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	for _, e := range entries {
+		typeflag := e.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		hdr := &tar.Header{
+			Name:     e.name,
+			Mode:     mode,
+			Typeflag: typeflag,
+			Linkname: e.linkname,
+		}
+		if typeflag == tar.TypeReg {
+			hdr.Size = int64(len(e.body))
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		if typeflag == tar.TypeReg {
+			_, err := tw.Write([]byte(e.body))
+			require.NoError(t, err)
+		}
+	}
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return &buf
+}
+
+func TestExtractStripsPrefix(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "node_modules", "pkg")
+	archive := buildArchive(t,
+		entry{name: "package/", typeflag: tar.TypeDir, mode: 0755},
+		entry{name: "package/package.json", body: `{"name":"pkg"}`},
+		entry{name: "package/lib/index.js", body: "module.exports = 1"},
+		entry{name: "package/bin/cli.js", body: "#!/usr/bin/env node", mode: 0755},
+	)
+
+	require.NoError(t, ExtractReader(archive, dest))
+
+	content, err := os.ReadFile(filepath.Join(dest, "package.json"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"name":"pkg"}`, string(content))
+	assert.FileExists(t, filepath.Join(dest, "lib", "index.js"))
+	assert.NoDirExists(t, filepath.Join(dest, "package"))
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(dest, "bin", "cli.js"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+		info, err = os.Stat(filepath.Join(dest, "lib", "index.js"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	}
+}
+
+func TestExtractNonStandardPrefix(t *testing.T) {
+	dest := t.TempDir()
+	archive := buildArchive(t, entry{name: "node/index.js", body: "x"})
+
+	require.NoError(t, ExtractReader(archive, dest))
+	assert.FileExists(t, filepath.Join(dest, "index.js"))
+}
+
+func TestExtractRejectsUnsafeEntries(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on windows")
+	}
+
+	tests := []struct {
+		name    string
+		entries []entry
+	}{
+		{
+			name:    "parent traversal",
+			entries: []entry{{name: "package/../../evil.js", body: "x"}},
+		},
+		{
+			name:    "absolute path",
+			entries: []entry{{name: "/tmp/evil.js", body: "x"}},
+		},
+		{
+			name: "symlink escaping destination",
+			entries: []entry{
+				{name: "package/link", typeflag: tar.TypeSymlink, linkname: "../../outside"},
+			},
+		},
+		{
+			name: "absolute symlink",
+			entries: []entry{
+				{name: "package/link", typeflag: tar.TypeSymlink, linkname: "/etc"},
+			},
+		},
+		{
+			name: "write through symlinked directory",
+			entries: []entry{
+				{name: "package/dir", typeflag: tar.TypeSymlink, linkname: "."},
+				{name: "package/dir/file.js", body: "x"},
+			},
+		},
+		{
+			name: "symlink chain escaping destination",
+			entries: []entry{
+				{name: "package/d/file.js", body: "x"},
+				{name: "package/a", typeflag: tar.TypeSymlink, linkname: "d/up/.."},
+				{name: "package/d/up", typeflag: tar.TypeSymlink, linkname: ".."},
+			},
+		},
+		{
+			name: "hardlink escaping destination",
+			entries: []entry{
+				{name: "package/link", typeflag: tar.TypeLink, linkname: "package/../../outside"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dest := filepath.Join(root, "node_modules", "pkg")
+
+			err := ExtractReader(buildArchive(t, tt.entries...), dest)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "unsafe")
+
+			_, err = os.Stat(filepath.Join(root, "evil.js"))
+			assert.True(t, os.IsNotExist(err))
+			assert.NoDirExists(t, dest)
+		})
+	}
+}
+
+func TestExtractInternalSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on windows")
+	}
+
+	dest := t.TempDir()
+	archive := buildArchive(t,
+		entry{name: "package/lib/index.js", body: "x"},
+		entry{name: "package/main.js", typeflag: tar.TypeSymlink, linkname: "lib/index.js"},
+	)
+
+	require.NoError(t, ExtractReader(archive, dest))
+
+	content, err := os.ReadFile(filepath.Join(dest, "main.js"))
+	require.NoError(t, err)
+	assert.Equal(t, "x", string(content))
+}
+
+func TestWalk(t *testing.T) {
+	archive := buildArchive(t,
+		entry{name: "package/main.js", typeflag: tar.TypeSymlink, linkname: "lib/index.js"},
+		entry{name: "package/lib/index.js", body: "x"},
+		entry{name: "package/bin/cli", body: "y", mode: 0775},
+		entry{name: "package/lib/copy.js", typeflag: tar.TypeLink, linkname: "package/lib/index.js"},
+	)
+
+	var seen []string
+	err := Walk(archive, func(e *Entry) error {
+		seen = append(seen, fmt.Sprintf("%c %s %o %s", e.Type, e.Path, e.Mode, e.Linkname))
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Symlinks are reported after every other entry
+	assert.Equal(t, []string{
+		"0 lib/index.js 644 ",
+		"0 bin/cli 755 ",
+		"1 lib/copy.js 0 lib/index.js",
+		"2 main.js 0 lib/index.js",
+	}, seen)
+}
+
+func TestExtractInvalidArchive(t *testing.T) {
+	err := ExtractReader(bytes.NewBufferString("not a tarball"), t.TempDir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid gzip stream")
+}
@@ -0,0 +1,205 @@
+// Package filelock provides advisory locks between processes sharing a
+// directory. A lock is a file created exclusively next to the resource it
+// guards, holding a token unique to its holder. The holder touches it
+// periodically, so a lock whose holder died is recognized by its age and
+// taken over. The token makes sure nobody removes a lock they do not own.
+package filelock
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// staleAfter is how long a lock may go without a heartbeat before it
+	// is considered abandoned
+	staleAfter = 30 * time.Second
+
+	// heartbeat is how often a held lock is touched
+	heartbeat = 10 * time.Second
+
+	// pollInterval is how often a waiter checks whether a lock is free
+	pollInterval = 50 * time.Millisecond
+)
+
+// Lock is a held lock
+type Lock struct {
+	path   string
+	token  []byte
+	stolen atomic.Bool
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// Acquire takes the lock at path, waiting while another process or
+// goroutine holds it. Stale locks are removed. Waiting ends with an error
+// when ctx is done.
+func Acquire(ctx context.Context, path string) (*Lock, error) {
+	for {
+		lock, err := tryAcquire(path)
+		if err == nil {
+			return lock, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+
+		if removeStale(path) {
+			continue
+		}
+
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for lock %s: %w", path, ctx.Err())
+		}
+	}
+}
+
+// tryAcquire creates the lock file, failing with os.ErrExist when it is
+// held
+func tryAcquire(path string) (*Lock, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Write(token)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	lock := &Lock{
+		path:  path,
+		token: token,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go lock.keepAlive()
+	return lock, nil
+}
+
+// newToken identifies a holder. The owner part is informational, for
+// anyone inspecting a stuck lock; the random part makes it unique.
+func newToken() ([]byte, error) {
+	random, err := randomHex()
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	return []byte(fmt.Sprintf("%d@%s %s\n", os.Getpid(), host, random)), nil
+}
+
+func randomHex() (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// owns reports whether the file at path holds the lock's token
+func (l *Lock) owns(path string) bool {
+	content, err := os.ReadFile(path)
+	return err == nil && bytes.Equal(content, l.token)
+}
+
+// keepAlive touches the lock file until the lock is released. It stops
+// once the file no longer holds the lock's token.
+func (l *Lock) keepAlive() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !l.owns(l.path) {
+				l.stolen.Store(true)
+				return
+			}
+			now := time.Now()
+			os.Chtimes(l.path, now, now)
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// removeStale removes the lock at path if its holder stopped touching it,
+// and reports whether it did
+func removeStale(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		// Released in the meantime
+		return errors.Is(err, os.ErrNotExist)
+	}
+	if time.Since(info.ModTime()) < staleAfter {
+		return false
+	}
+	token, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Is(err, os.ErrNotExist)
+	}
+	return removeIfStale(path, token)
+}
+
+// removeIfStale removes the lock at path if it still holds token and is
+// still stale. The file is first moved aside under a name of its own, so
+// the check and the removal concern the same file: if what was moved turns
+// out to be a lock taken over or touched in the meantime, it is put back.
+func removeIfStale(path string, token []byte) bool {
+	suffix, err := randomHex()
+	if err != nil {
+		return false
+	}
+	aside := path + ".stale-" + suffix
+	if err := os.Rename(path, aside); err != nil {
+		return errors.Is(err, os.ErrNotExist)
+	}
+
+	moved, readErr := os.ReadFile(aside)
+	info, statErr := os.Stat(aside)
+	if readErr == nil && statErr == nil && bytes.Equal(moved, token) && time.Since(info.ModTime()) >= staleAfter {
+		os.Remove(aside)
+		return true
+	}
+
+	// A live lock was moved: restore it unless someone locked path since,
+	// in which case its holder notices the theft on its next heartbeat
+	os.Link(aside, path)
+	os.Remove(aside)
+	return false
+}
+
+// Release gives up the lock. The file is only removed while it still
+// holds the lock's token; a lock that was taken over is left to its new
+// holder and reported as an error.
+func (l *Lock) Release() error {
+	close(l.stop)
+	<-l.done
+
+	if l.stolen.Load() || !l.owns(l.path) {
+		return fmt.Errorf("lock %s was taken over by another process", l.path)
+	}
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to unlock %s: %w", l.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package filelock
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireExcludesOtherHolders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entry.lock")
+
+	var holders, maxHolders atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock, err := Acquire(context.Background(), path)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			n := holders.Add(1)
+			for {
+				max := maxHolders.Load()
+				if n <= max || maxHolders.CompareAndSwap(max, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			holders.Add(-1)
+
+			assert.NoError(t, lock.Release())
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(1), maxHolders.Load())
+	assert.NoFileExists(t, path)
+}
+
+func TestAcquireTakesOverStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entry.lock")
+
+	// A lock left behind by a process that died long ago
+	require.NoError(t, os.WriteFile(path, []byte("12345@elsewhere\n"), 0644))
+	old := time.Now().Add(-2 * staleAfter)
+	require.NoError(t, os.Chtimes(path, old, old))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	lock, err := Acquire(ctx, path)
+	require.NoError(t, err)
+	require.NoError(t, lock.Release())
+}
+
+func TestHeldLockIsKeptAlive(t *testing.T) {
+	defer func(s, h time.Duration) { staleAfter, heartbeat = s, h }(staleAfter, heartbeat)
+	staleAfter = 200 * time.Millisecond
+	heartbeat = 20 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "entry.lock")
+	lock, err := Acquire(context.Background(), path)
+	require.NoError(t, err)
+	defer lock.Release()
+
+	// The holder outlives staleAfter, but its heartbeat keeps waiters out
+	ctx, cancel := context.WithTimeout(context.Background(), 3*staleAfter)
+	defer cancel()
+	_, err = Acquire(ctx, path)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestReleaseKeepsStolenLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entry.lock")
+	lock, err := Acquire(context.Background(), path)
+	require.NoError(t, err)
+
+	// Another process took the lock over, believing it stale
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.WriteFile(path, []byte("12345@elsewhere other\n"), 0644))
+
+	assert.Error(t, lock.Release())
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "12345@elsewhere other\n", string(content))
+}
+
+func TestHeartbeatNoticesStolenLock(t *testing.T) {
+	defer func(h time.Duration) { heartbeat = h }(heartbeat)
+	heartbeat = 10 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "entry.lock")
+	lock, err := Acquire(context.Background(), path)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("12345@elsewhere other\n"), 0644))
+	assert.Eventually(t, lock.stolen.Load, time.Second, 5*time.Millisecond)
+
+	// Even if the file is rewritten with the original token later, a
+	// lock known to be stolen is not removed
+	require.NoError(t, os.WriteFile(path, lock.token, 0644))
+	assert.Error(t, lock.Release())
+	assert.FileExists(t, path)
+}
+
+func TestRemoveStaleRestoresLiveLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entry.lock")
+	staleToken := []byte("12345@elsewhere dead\n")
+
+	// A waiter judged the dead holder's lock stale, but another waiter
+	// removed it and took the lock before the first one got to it
+	lock, err := Acquire(context.Background(), path)
+	require.NoError(t, err)
+	assert.False(t, removeIfStale(path, staleToken))
+	assert.True(t, lock.owns(path))
+
+	// The same applies when the holder was only slow and touched it again
+	require.NoError(t, os.WriteFile(path, staleToken, 0644))
+	assert.False(t, removeIfStale(path, staleToken))
+	assert.FileExists(t, path)
+
+	old := time.Now().Add(-2 * staleAfter)
+	require.NoError(t, os.Chtimes(path, old, old))
+	assert.True(t, removeIfStale(path, staleToken))
+
+	// Nothing moved aside is left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.Error(t, lock.Release())
+}
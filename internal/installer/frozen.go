@@ -0,0 +1,87 @@
+package installer
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/marpit19/zap-pm/internal/errors"
+	"github.com/marpit19/zap-pm/internal/lockfile"
+	"github.com/marpit19/zap-pm/internal/registry"
+)
+
+// Drift describes one way package.json and the lock file disagree
+type Drift struct {
+	Name      string
+	Specifier string // specifier in package.json, empty when removed
+	Locked    string // locked version, empty when not locked
+}
+
+// String formats the drift as a line of a diff
+func (d Drift) String() string {
+	switch {
+	case d.Locked == "":
+		return fmt.Sprintf("+ %s@%s (not in %s)", d.Name, d.Specifier, lockfile.FileName)
+	case d.Specifier == "":
+		return fmt.Sprintf("- %s@%s (not in package.json)", d.Name, d.Locked)
+	default:
+		return fmt.Sprintf("~ %s: package.json wants %s, %s has %s", d.Name, d.Specifier, lockfile.FileName, d.Locked)
+	}
+}
+
+// LockDrift lists every direct dependency whose specifier in deps is not
+// satisfied by the locked version, sorted by name
+func LockDrift(lock *lockfile.Lockfile, deps map[string]string) []Drift {
+	var drift []Drift
+
+	for name, spec := range deps {
+		locked, ok := lock.Dependencies[name]
+		if !ok {
+			drift = append(drift, Drift{Name: name, Specifier: spec})
+			continue
+		}
+		if locked.Specifier == spec {
+			continue
+		}
+		if ok, err := registry.Satisfies(locked.Version, spec); err != nil || !ok {
+			drift = append(drift, Drift{Name: name, Specifier: spec, Locked: locked.Version})
+		}
+	}
+
+	for name, locked := range lock.Dependencies {
+		if _, ok := deps[name]; !ok {
+			drift = append(drift, Drift{Name: name, Locked: locked.Version})
+		}
+	}
+
+	sort.Slice(drift, func(i, j int) bool {
+		return drift[i].Name < drift[j].Name
+	})
+	return drift
+}
+
+// frozenGraph builds the graph purely from the lock file, failing when the
+// lock is missing or does not satisfy deps
+func frozenGraph(dir string, deps map[string]string) (*Graph, error) {
+	lock, err := lockfile.Read(filepath.Join(dir, lockfile.FileName))
+	if err != nil {
+		return nil, errors.Wrap(err, "a valid lock file is required with --frozen-lockfile")
+	}
+
+	if drift := LockDrift(lock, deps); len(drift) > 0 {
+		lines := make([]string, len(drift))
+		for i, d := range drift {
+			lines[i] = "  " + d.String()
+		}
+		message := fmt.Sprintf("package.json and %s are out of sync:\n%s\nRun zap install to update the lock file",
+			lockfile.FileName, strings.Join(lines, "\n"))
+		return nil, errors.New(lockfile.ErrLockfileOutOfSync, message, nil)
+	}
+
+	roots := make(map[string]string, len(deps))
+	for name := range deps {
+		roots[name] = lock.Dependencies[name].Version
+	}
+	return walkLock(lock, roots), nil
+}
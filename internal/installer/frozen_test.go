@@ -0,0 +1,92 @@
+package installer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marpit19/zap-pm/internal/lockfile"
+	"github.com/marpit19/zap-pm/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockDrift(t *testing.T) {
+	lock := lockfile.New()
+	lock.Dependencies["kept"] = lockfile.Dependency{Specifier: "^1.0.0", Version: "1.2.0"}
+	lock.Dependencies["widened"] = lockfile.Dependency{Specifier: "1.2.0", Version: "1.2.0"}
+	lock.Dependencies["bumped"] = lockfile.Dependency{Specifier: "^1.0.0", Version: "1.4.0"}
+	lock.Dependencies["removed"] = lockfile.Dependency{Specifier: "^3.0.0", Version: "3.1.0"}
+
+	deps := map[string]string{
+		"kept":    "^1.0.0",
+		"widened": "^1.0.0",
+		"bumped":  "^2.0.0",
+		"added":   "~0.1.0",
+	}
+
+	var lines []string
+	for _, d := range LockDrift(lock, deps) {
+		lines = append(lines, d.String())
+	}
+	assert.Equal(t, []string{
+		"+ added@~0.1.0 (not in zap-lock.json)",
+		"~ bumped: package.json wants ^2.0.0, zap-lock.json has 1.4.0",
+		"- removed@3.1.0 (not in package.json)",
+	}, lines)
+}
+
+func TestFrozenLockfileInstall(t *testing.T) {
+	mr := newMockRegistry(
+		mockPackage{name: "app-lib", version: "1.0.0", deps: map[string]string{"leaf": "^1.0.0"}},
+		mockPackage{name: "leaf", version: "1.0.0"},
+	)
+	defer mr.server.Close()
+
+	dir := t.TempDir()
+	pkg := &parser.PackageJSON{
+		Name:         "project",
+		Version:      "1.0.0",
+		Dependencies: map[string]string{"app-lib": "^1.0.0"},
+	}
+
+	// Without a lock file a frozen install refuses to run
+	_, err := setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true, FrozenLockfile: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), lockfile.ErrLockfileNotFound)
+	assert.NoDirExists(t, filepath.Join(dir, "node_modules"))
+
+	_, err = setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true})
+	require.NoError(t, err)
+
+	lockPath := filepath.Join(dir, lockfile.FileName)
+	original, err := os.ReadFile(lockPath)
+	require.NoError(t, err)
+
+	// A clean frozen install recreates node_modules from the lock alone
+	stale := filepath.Join(dir, "node_modules", "stale")
+	require.NoError(t, os.MkdirAll(stale, 0755))
+	mr.metadata = make(map[string]int)
+
+	result, err := setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true, FrozenLockfile: true, Clean: true})
+	require.NoError(t, err)
+	assert.False(t, result.LockfileWritten)
+	assert.Empty(t, mr.metadata)
+	assert.NoDirExists(t, stale)
+	assert.FileExists(t, filepath.Join(dir, "node_modules", "leaf", "package.json"))
+
+	// Drift is reported and the lock file is left untouched
+	pkg.Dependencies["app-lib"] = "^2.0.0"
+	pkg.Dependencies["extra"] = "1.0.0"
+	_, err = setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true, FrozenLockfile: true, Clean: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "out of sync")
+	assert.Contains(t, err.Error(), "~ app-lib: package.json wants ^2.0.0, zap-lock.json has 1.0.0")
+	assert.Contains(t, err.Error(), "+ extra@1.0.0")
+	assert.FileExists(t, filepath.Join(dir, "node_modules", "leaf", "package.json"))
+
+	current, err := os.ReadFile(lockPath)
+	require.NoError(t, err)
+	assert.Equal(t, string(original), string(current))
+}
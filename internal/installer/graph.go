@@ -0,0 +1,74 @@
+package installer
+
+import (
+	"context"
+	"sort"
+
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/marpit19/zap-pm/internal/registry"
+	"github.com/marpit19/zap-pm/internal/resolver"
+)
+
+// Node is a single package version in the resolved dependency graph
+type Node struct {
+	Name         string
+	Version      string
+	Dist         registry.Dist
+	Dependencies map[string]string // dependency name -> resolved version
+}
+
+// Key returns the name@version identifier of the node
+func (n *Node) Key() string {
+	return packageKey(n.Name, n.Version)
+}
+
+// Graph is the fully resolved, deduplicated dependency graph of a project
+type Graph struct {
+	Root  map[string]string // direct dependency name -> resolved version
+	Nodes map[string]*Node  // keyed by name@version
+}
+
+// Sorted returns the graph nodes ordered by name and version
+func (g *Graph) Sorted() []*Node {
+	nodes := make([]*Node, 0, len(g.Nodes))
+	for _, node := range g.Nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Name != nodes[j].Name {
+			return nodes[i].Name < nodes[j].Name
+		}
+		return nodes[i].Version < nodes[j].Version
+	})
+	return nodes
+}
+
+// ResolveGraph resolves deps and every transitive dependency, weighing all
+// constraints on a package together and backtracking over conflicting
+// choices. Identical name@version pairs appear once in the graph.
+func ResolveGraph(ctx context.Context, source resolver.Source, deps map[string]string, opts resolver.Options, log *logger.Logger) (*Graph, error) {
+	res, err := resolver.New(source, opts, log).Resolve(ctx, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &Graph{
+		Root:  res.Root,
+		Nodes: make(map[string]*Node, len(res.Packages)),
+	}
+	for key, pkg := range res.Packages {
+		graph.Nodes[key] = &Node{
+			Name:         pkg.Name,
+			Version:      pkg.Version,
+			Dist:         pkg.Dist,
+			Dependencies: pkg.Dependencies,
+		}
+	}
+
+	log.Debugf("Resolved %d packages", len(graph.Nodes))
+	return graph, nil
+}
+
+func packageKey(name, version string) string {
+	return name + "@" + version
+}
@@ -0,0 +1,173 @@
+package installer
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// NestedPackage explains why a package could not be hoisted to the top
+// level of node_modules
+type NestedPackage struct {
+	Path       string // where the package was placed
+	Node       *Node
+	RequiredBy string // name@version of the dependent that needed it
+	Blocker    string // path of the package that prevented hoisting it higher
+	Reason     string
+}
+
+// String formats the entry as a line of the nesting report
+func (n NestedPackage) String() string {
+	return fmt.Sprintf("%s at %s (required by %s): %s", n.Node.Key(), n.Path, n.RequiredBy, n.Reason)
+}
+
+// resolvedEdge records where a package finds one of its dependencies
+type resolvedEdge struct {
+	from string // path of the dependent, empty for the project root
+	name string
+	to   string // path of the dependency
+}
+
+// hoister places packages the way npm does: as high in the node_modules
+// tree as possible, nesting only where a different version is in the way
+type hoister struct {
+	placed map[string]*Node
+	edges  []resolvedEdge
+	nested []NestedPackage
+}
+
+// planHoisted lays the graph out npm style. Packages are processed breadth
+// first, direct dependencies first and siblings by name, so the shallowest
+// and then alphabetically first dependent wins a contested slot and every
+// machine produces the same tree.
+func planHoisted(graph *Graph) *Layout {
+	h := &hoister{placed: make(map[string]*Node)}
+
+	type pending struct {
+		path string
+		node *Node
+	}
+	var queue []pending
+
+	for _, name := range sortedKeys(graph.Root) {
+		node := graph.Nodes[packageKey(name, graph.Root[name])]
+		p := path.Join(nodeModulesDir, name)
+		h.placed[p] = node
+		h.edges = append(h.edges, resolvedEdge{from: "", name: name, to: p})
+		queue = append(queue, pending{path: p, node: node})
+	}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, name := range sortedKeys(current.node.Dependencies) {
+			dep := graph.Nodes[packageKey(name, current.node.Dependencies[name])]
+			if p, placed := h.place(current.path, current.node, dep); placed {
+				queue = append(queue, pending{path: p, node: dep})
+			}
+		}
+	}
+
+	placements := make([]Placement, 0, len(h.placed))
+	for p, node := range h.placed {
+		placements = append(placements, Placement{Path: p, Node: node})
+	}
+	sort.Slice(placements, func(i, j int) bool {
+		return placements[i].Path < placements[j].Path
+	})
+	sort.Slice(h.nested, func(i, j int) bool {
+		return h.nested[i].Path < h.nested[j].Path
+	})
+
+	return &Layout{Placements: placements, Nested: h.nested}
+}
+
+// place finds the location from which the package at from resolves dep.
+// It reports the path and whether dep had to be placed there; an existing
+// copy of the same version that is already visible is reused instead.
+func (h *hoister) place(from string, dependent, dep *Node) (string, bool) {
+	var best, blocker, reason string
+
+	for _, dir := range resolutionDirs(from) {
+		candidate := path.Join(dir, nodeModulesDir, dep.Name)
+
+		if existing, ok := h.placed[candidate]; ok {
+			if existing.Version == dep.Version {
+				h.edges = append(h.edges, resolvedEdge{from: from, name: dep.Name, to: candidate})
+				return candidate, false
+			}
+			blocker = candidate
+			reason = fmt.Sprintf("%s holds %s", candidate, existing.Key())
+			break
+		}
+
+		if edge, ok := h.shadowed(dir, dep); ok {
+			blocker = edge.to
+			reason = fmt.Sprintf("%s relies on %s at %s", packagePathLabel(edge.from), h.placed[edge.to].Key(), edge.to)
+			break
+		}
+
+		best = candidate
+	}
+
+	h.placed[best] = dep
+	h.edges = append(h.edges, resolvedEdge{from: from, name: dep.Name, to: best})
+
+	if best != path.Join(nodeModulesDir, dep.Name) {
+		h.nested = append(h.nested, NestedPackage{
+			Path:       best,
+			Node:       dep,
+			RequiredBy: dependent.Key(),
+			Blocker:    blocker,
+			Reason:     reason,
+		})
+	}
+	return best, true
+}
+
+// shadowed reports an already resolved edge that would start resolving to
+// dep instead of a different version if dep were placed in dir's
+// node_modules
+func (h *hoister) shadowed(dir string, dep *Node) (resolvedEdge, bool) {
+	for _, edge := range h.edges {
+		if edge.name != dep.Name || !inScope(dir, edge.from) || inScope(dir, edge.to) {
+			continue
+		}
+		if h.placed[edge.to].Version != dep.Version {
+			return edge, true
+		}
+	}
+	return resolvedEdge{}, false
+}
+
+// inScope reports whether the package at p resolves modules through the
+// node_modules directory of the package at dir
+func inScope(dir, p string) bool {
+	return dir == "" || p == dir || strings.HasPrefix(p, dir+"/"+nodeModulesDir+"/")
+}
+
+// resolutionDirs lists the package directories whose node_modules Node
+// searches from the package at p, nearest first, ending with the project
+// root ("")
+func resolutionDirs(p string) []string {
+	var dirs []string
+	for p != "" {
+		dirs = append(dirs, p)
+		idx := strings.LastIndex(p, "/"+nodeModulesDir+"/")
+		if idx < 0 {
+			break
+		}
+		p = p[:idx]
+	}
+	return append(dirs, "")
+}
+
+// packagePathLabel names the package at p for the nesting report
+func packagePathLabel(p string) string {
+	if p == "" {
+		return "the project"
+	}
+	return p
+}
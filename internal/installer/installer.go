@@ -0,0 +1,374 @@
+package installer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/marpit19/zap-pm/internal/downloader"
+	"github.com/marpit19/zap-pm/internal/lockfile"
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/marpit19/zap-pm/internal/parser"
+	"github.com/marpit19/zap-pm/internal/registry"
+	"github.com/marpit19/zap-pm/internal/resolver"
+	"github.com/marpit19/zap-pm/internal/store"
+)
+
+const (
+	defaultConcurrency = 3
+)
+
+// Options configures an install run
+type Options struct {
+	Dir            string // project directory, defaults to the working directory
+	Concurrency    int
+	UseCache       bool
+	ShowProgress   bool
+	FrozenLockfile bool   // install strictly from the lock file and never modify it
+	Clean          bool   // remove node_modules before linking
+	Linker         string // node_modules layout, defaults to the project setting
+	SingleVersion  bool   // allow only one version of every package, also set by the project
+	Offline        bool   // install from the tarball cache only
+}
+
+// Result contains the outcome of an install run
+type Result struct {
+	Graph           *Graph
+	Downloads       []*downloader.DownloadResult
+	Layout          *Layout
+	LockfileWritten bool
+}
+
+// Installer resolves a project's dependencies and materializes them
+type Installer struct {
+	registry  *registry.RegistryClient
+	downloads *downloader.DownloadManager
+	store     *store.Store
+	log       *logger.Logger
+}
+
+// New creates a new installer
+func New(registryClient *registry.RegistryClient, dm *downloader.DownloadManager, packageStore *store.Store, log *logger.Logger) *Installer {
+	return &Installer{
+		registry:  registryClient,
+		downloads: dm,
+		store:     packageStore,
+		log:       log,
+	}
+}
+
+// Install resolves the full dependency graph of pkg, downloads every
+// package in it exactly once and links the result into node_modules.
+// The resolution is recorded in the project's lock file, and locked
+// entries are reused instead of being resolved again. With FrozenLockfile
+// the lock file is the only source of truth and is never written.
+// Canceling ctx stops resolution and downloads before node_modules is
+// touched.
+func (i *Installer) Install(ctx context.Context, pkg *parser.PackageJSON, opts Options) (*Result, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.Dir == "" {
+		opts.Dir = "."
+	}
+	if opts.Linker == "" {
+		opts.Linker = ProjectLinker(pkg)
+	}
+	if pkg.Zap != nil && pkg.Zap.SingleVersion {
+		opts.SingleVersion = true
+	}
+
+	deps := ProjectDependencies(pkg)
+
+	var graph *Graph
+	var err error
+	if opts.FrozenLockfile {
+		graph, err = frozenGraph(opts.Dir, deps)
+	} else {
+		graph, err = i.resolve(ctx, deps, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	i.log.Infof("Resolved %d packages", len(graph.Nodes))
+
+	layout, err := planLayout(opts.Linker, graph)
+	if err != nil {
+		return nil, err
+	}
+
+	downloads, err := i.download(ctx, graph, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if opts.Clean {
+		if err := os.RemoveAll(filepath.Join(opts.Dir, nodeModulesDir)); err != nil {
+			return nil, fmt.Errorf("failed to remove %s: %w", nodeModulesDir, err)
+		}
+	} else if err := i.prune(layout, opts.Dir); err != nil {
+		return nil, err
+	}
+
+	if err := i.link(layout, downloads, opts.Dir); err != nil {
+		return nil, err
+	}
+	i.log.Infof("Linked %d packages into %s (%s layout)", len(layout.Placements), nodeModulesDir, opts.Linker)
+	if len(layout.Nested) > 0 {
+		i.log.Infof("%d packages could not be hoisted:", len(layout.Nested))
+		for _, nested := range layout.Nested {
+			i.log.Infof("  %s", nested)
+		}
+	}
+
+	result := &Result{
+		Graph:     graph,
+		Downloads: downloads,
+		Layout:    layout,
+	}
+	if opts.FrozenLockfile {
+		return result, nil
+	}
+
+	written, err := lockFromGraph(graph, deps).WriteToFile(filepath.Join(opts.Dir, lockfile.FileName))
+	if err != nil {
+		return nil, err
+	}
+	if written {
+		i.log.Infof("Updated %s", lockfile.FileName)
+	}
+	result.LockfileWritten = written
+
+	return result, nil
+}
+
+// resolve builds the dependency graph. When no specifier changed since the
+// lock file was written, the locked graph is used as is. Otherwise the
+// whole graph is resolved again, so constraints of new dependencies are
+// weighed against locked packages too, keeping the locked versions of
+// unchanged dependencies wherever they still fit.
+func (i *Installer) resolve(ctx context.Context, deps map[string]string, opts Options) (*Graph, error) {
+	lockPath := filepath.Join(opts.Dir, lockfile.FileName)
+	if _, err := os.Stat(lockPath); err != nil {
+		i.log.Infof("Resolving %d direct dependencies...", len(deps))
+		return ResolveGraph(ctx, i.registry, deps, resolveOptions(opts), i.log)
+	}
+
+	lock, err := lockfile.Read(lockPath)
+	if err != nil {
+		i.log.Warnf("Ignoring %s: %v", lockfile.FileName, err)
+		i.log.Infof("Resolving %d direct dependencies...", len(deps))
+		return ResolveGraph(ctx, i.registry, deps, resolveOptions(opts), i.log)
+	}
+
+	graph, unresolved := graphFromLock(lock, deps)
+	if len(unresolved) == 0 {
+		i.log.Infof("Using locked versions from %s", lockfile.FileName)
+		return graph, nil
+	}
+
+	i.log.Infof("Resolving %d dependencies changed since %s was written...", len(unresolved), lockfile.FileName)
+	resolveOpts := resolveOptions(opts)
+	resolveOpts.Preferred = lockedVersions(graph)
+	return ResolveGraph(ctx, i.registry, deps, resolveOpts, i.log)
+}
+
+func resolveOptions(opts Options) resolver.Options {
+	return resolver.Options{
+		SingleVersion: opts.SingleVersion,
+		Concurrency:   opts.Concurrency,
+	}
+}
+
+// link imports every downloaded package into the store and links it into
+// the project's node_modules. Placements are sorted, so parents are always
+// linked before the packages nested inside them. Symlinks are created once
+// every package is in place.
+func (i *Installer) link(layout *Layout, downloads []*downloader.DownloadResult, dir string) error {
+	indexes := make(map[string]*store.Index, len(downloads))
+	for _, download := range downloads {
+		index, err := i.store.Import(download.PackageName, download.Version, download.Integrity, download.Path)
+		if err != nil {
+			return err
+		}
+		indexes[packageKey(download.PackageName, download.Version)] = index
+	}
+
+	for _, placement := range layout.Placements {
+		target := filepath.Join(dir, filepath.FromSlash(placement.Path))
+		if err := os.RemoveAll(target); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", placement.Path, err)
+		}
+
+		i.log.Debugf("Linking %s to %s", placement.Node.Key(), placement.Path)
+		if err := i.store.Link(indexes[placement.Node.Key()], target); err != nil {
+			return err
+		}
+	}
+
+	for _, symlink := range layout.Symlinks {
+		linkPath := filepath.Join(dir, filepath.FromSlash(symlink.Path))
+		if err := os.RemoveAll(linkPath); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", symlink.Path, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", symlink.Path, err)
+		}
+
+		// Relative targets keep the project relocatable
+		target, err := filepath.Rel(filepath.Dir(linkPath), filepath.Join(dir, filepath.FromSlash(symlink.Target)))
+		if err != nil {
+			return fmt.Errorf("failed to link %s: %w", symlink.Path, err)
+		}
+		if err := os.Symlink(target, linkPath); err != nil {
+			return fmt.Errorf("failed to link %s: %w", symlink.Path, err)
+		}
+	}
+	return nil
+}
+
+// prune removes the top level node_modules entries the layout does not
+// place, such as packages dropped from the project or left behind by
+// another linker. Without it, switching from the hoisted to the isolated
+// linker would keep transitive packages resolvable from the project.
+// Entries under node_modules/.zap are pruned the same way. Other dot
+// entries belong to other tools and are kept.
+func (i *Installer) prune(layout *Layout, dir string) error {
+	keep := layout.topLevel()
+	root := filepath.Join(dir, nodeModulesDir)
+
+	remove := func(rel string) error {
+		i.log.Debugf("Removing %s/%s, which is not part of the layout", nodeModulesDir, rel)
+		if err := os.RemoveAll(filepath.Join(root, filepath.FromSlash(rel))); err != nil {
+			return fmt.Errorf("failed to remove %s/%s: %w", nodeModulesDir, rel, err)
+		}
+		return nil
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read %s: %w", nodeModulesDir, err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case name == isolatedStoreDir, strings.HasPrefix(name, "@") && entry.IsDir():
+			// Prune the children, then the directory if nothing is kept
+			children, err := os.ReadDir(filepath.Join(root, name))
+			if err != nil {
+				return fmt.Errorf("failed to read %s/%s: %w", nodeModulesDir, name, err)
+			}
+			kept := 0
+			for _, child := range children {
+				if rel := name + "/" + child.Name(); keep[rel] {
+					kept++
+				} else if err := remove(rel); err != nil {
+					return err
+				}
+			}
+			if kept == 0 {
+				if err := remove(name); err != nil {
+					return err
+				}
+			}
+		case strings.HasPrefix(name, "."):
+		case !keep[name]:
+			if err := remove(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// download fetches every node of the graph into the cache
+func (i *Installer) download(ctx context.Context, graph *Graph, opts Options) ([]*downloader.DownloadResult, error) {
+	nodes := graph.Sorted()
+
+	var wg sync.WaitGroup
+	resultsChan := make(chan *downloader.DownloadResult, len(nodes))
+	errorsChan := make(chan error, len(nodes))
+	semaphore := make(chan struct{}, opts.Concurrency)
+
+	downloadOpts := downloader.DownloadOptions{
+		Concurrency:  opts.Concurrency,
+		UseCache:     opts.UseCache,
+		ShowProgress: opts.ShowProgress,
+		Offline:      opts.Offline,
+	}
+
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node *Node) {
+			defer wg.Done()
+
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				errorsChan <- fmt.Errorf("failed to download %s: %w", node.Key(), ctx.Err())
+				return
+			}
+			defer func() { <-semaphore }()
+
+			result, err := i.downloads.DownloadDist(ctx, node.Name, node.Version, node.Dist, downloadOpts)
+			if err != nil {
+				errorsChan <- fmt.Errorf("failed to download %s: %w", node.Key(), err)
+				return
+			}
+			resultsChan <- result
+		}(node)
+	}
+
+	wg.Wait()
+	close(resultsChan)
+	close(errorsChan)
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("downloads canceled: %w", err)
+	}
+
+	var downloadErrors []error
+	for err := range errorsChan {
+		downloadErrors = append(downloadErrors, err)
+	}
+	if len(downloadErrors) > 0 {
+		return nil, fmt.Errorf("some packages failed to download: %v", downloadErrors)
+	}
+
+	results := make([]*downloader.DownloadResult, 0, len(nodes))
+	for result := range resultsChan {
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ProjectLinker returns the node_modules layout configured in package.json
+func ProjectLinker(pkg *parser.PackageJSON) string {
+	if pkg.Zap != nil && pkg.Zap.Linker != "" {
+		return pkg.Zap.Linker
+	}
+	return LinkerHoisted
+}
+
+// ProjectDependencies merges dependencies and devDependencies of pkg.
+// Entries in dependencies take precedence over devDependencies.
+func ProjectDependencies(pkg *parser.PackageJSON) map[string]string {
+	deps := make(map[string]string, len(pkg.Dependencies)+len(pkg.DevDependencies))
+	for name, spec := range pkg.DevDependencies {
+		deps[name] = spec
+	}
+	for name, spec := range pkg.Dependencies {
+		deps[name] = spec
+	}
+	return deps
+}
@@ -0,0 +1,690 @@
+package installer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/marpit19/zap-pm/internal/downloader"
+	"github.com/marpit19/zap-pm/internal/lockfile"
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/marpit19/zap-pm/internal/parser"
+	"github.com/marpit19/zap-pm/internal/registry"
+	"github.com/marpit19/zap-pm/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockPackage describes one published version served by the mock registry
+type mockPackage struct {
+	name    string
+	version string
+	deps    map[string]string
+}
+
+// mockRegistry serves packuments and tarballs for a fixed set of packages
+type mockRegistry struct {
+	server   *httptest.Server
+	packages map[string][]mockPackage
+	tarballs map[string][]byte
+
+	mu        sync.Mutex
+	downloads map[string]int
+	metadata  map[string]int
+}
+
+// buildTarball creates an npm style tarball containing a package.json
+func buildTarball(pkg mockPackage) []byte {
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"name":         pkg.name,
+		"version":      pkg.version,
+		"dependencies": pkg.deps,
+	})
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "package/package.json", Mode: 0644, Size: int64(len(manifest))})
+	tw.Write(manifest)
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func newMockRegistry(pkgs ...mockPackage) *mockRegistry {
+	mr := &mockRegistry{
+		packages:  make(map[string][]mockPackage),
+		tarballs:  make(map[string][]byte),
+		downloads: make(map[string]int),
+		metadata:  make(map[string]int),
+	}
+	for _, pkg := range pkgs {
+		mr.packages[pkg.name] = append(mr.packages[pkg.name], pkg)
+		mr.tarballs[pkg.name+"@"+pkg.version] = buildTarball(pkg)
+	}
+
+	mr.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(r.URL.Path, "/")
+		if strings.HasSuffix(path, ".tgz") {
+			key := strings.TrimSuffix(strings.Replace(path, "/-/", "@", 1), ".tgz")
+			tarball, ok := mr.tarballs[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			mr.mu.Lock()
+			mr.downloads[key]++
+			mr.mu.Unlock()
+			w.Write(tarball)
+			return
+		}
+
+		mr.mu.Lock()
+		mr.metadata[path]++
+		mr.mu.Unlock()
+
+		versions, ok := mr.packages[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(mr.packument(path, versions))
+	}))
+
+	return mr
+}
+
+func (mr *mockRegistry) packument(name string, versions []mockPackage) registry.PackageMetadata {
+	meta := registry.PackageMetadata{
+		Name:     name,
+		Versions: make(map[string]registry.VersionInfo),
+		DistTags: make(map[string]string),
+	}
+	for _, pkg := range versions {
+		hash := sha1.Sum(mr.tarballs[name+"@"+pkg.version])
+		meta.Versions[pkg.version] = registry.VersionInfo{
+			Version:      pkg.version,
+			Dependencies: pkg.deps,
+			Dist: registry.Dist{
+				Tarball: fmt.Sprintf("%s/%s/-/%s.tgz", mr.server.URL, name, pkg.version),
+				Shasum:  hex.EncodeToString(hash[:]),
+			},
+		}
+		meta.DistTags["latest"] = pkg.version
+	}
+	return meta
+}
+
+func setupInstaller(t *testing.T, mr *mockRegistry) *Installer {
+	log := logger.New()
+	client := registry.NewRegistryClient(log)
+	client.SetBaseURL(mr.server.URL)
+
+	cacheDir := t.TempDir()
+	dm := downloader.NewDownloadManager(client, cacheDir, log)
+	return New(client, dm, store.New(t.TempDir(), log), log)
+}
+
+func TestInstallResolvesTransitiveGraph(t *testing.T) {
+	mr := newMockRegistry(
+		mockPackage{name: "app-lib", version: "1.0.0", deps: map[string]string{"shared": "^1.0.0", "leaf": "1.0.0"}},
+		mockPackage{name: "app-lib", version: "1.2.0", deps: map[string]string{"shared": "^1.0.0", "leaf": "1.0.0"}},
+		mockPackage{name: "tool", version: "2.0.0", deps: map[string]string{"shared": "1.1.0"}},
+		mockPackage{name: "shared", version: "1.0.0"},
+		mockPackage{name: "shared", version: "1.1.0", deps: map[string]string{"leaf": "^1.0.0"}},
+		mockPackage{name: "leaf", version: "1.0.0"},
+	)
+	defer mr.server.Close()
+
+	inst := setupInstaller(t, mr)
+	pkg := &parser.PackageJSON{
+		Name:            "project",
+		Version:         "1.0.0",
+		Dependencies:    map[string]string{"app-lib": "^1.0.0"},
+		DevDependencies: map[string]string{"tool": "2.0.0"},
+	}
+
+	result, err := inst.Install(context.Background(), pkg, Options{Dir: t.TempDir(), UseCache: true, Concurrency: 2})
+	require.NoError(t, err)
+
+	graph := result.Graph
+	assert.Equal(t, map[string]string{"app-lib": "1.2.0", "tool": "2.0.0"}, graph.Root)
+
+	var keys []string
+	for _, node := range graph.Sorted() {
+		keys = append(keys, node.Key())
+	}
+	assert.Equal(t, []string{"app-lib@1.2.0", "leaf@1.0.0", "shared@1.1.0", "tool@2.0.0"}, keys)
+	assert.Equal(t, map[string]string{"shared": "1.1.0", "leaf": "1.0.0"}, graph.Nodes["app-lib@1.2.0"].Dependencies)
+	assert.Equal(t, map[string]string{"leaf": "1.0.0"}, graph.Nodes["shared@1.1.0"].Dependencies)
+
+	// Every tarball is fetched exactly once
+	require.Len(t, result.Downloads, 4)
+	for _, download := range result.Downloads {
+		assert.FileExists(t, download.Path)
+	}
+	for key, count := range mr.downloads {
+		assert.Equal(t, 1, count, "tarball %s downloaded more than once", key)
+	}
+}
+
+func TestInstallMissingDependency(t *testing.T) {
+	mr := newMockRegistry(
+		mockPackage{name: "app-lib", version: "1.0.0", deps: map[string]string{"ghost": "^1.0.0"}},
+	)
+	defer mr.server.Close()
+
+	inst := setupInstaller(t, mr)
+	pkg := &parser.PackageJSON{
+		Name:         "project",
+		Version:      "1.0.0",
+		Dependencies: map[string]string{"app-lib": "1.0.0"},
+	}
+
+	_, err := inst.Install(context.Background(), pkg, Options{Dir: t.TempDir(), UseCache: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ghost@^1.0.0")
+	assert.Contains(t, err.Error(), "required by app-lib@1.0.0")
+}
+
+func TestInstallExtractsNodeModules(t *testing.T) {
+	mr := newMockRegistry(
+		mockPackage{name: "app-lib", version: "1.0.0", deps: map[string]string{"shared": "^2.0.0"}},
+		mockPackage{name: "shared", version: "1.0.0"},
+		mockPackage{name: "shared", version: "2.0.0"},
+	)
+	defer mr.server.Close()
+
+	inst := setupInstaller(t, mr)
+	pkg := &parser.PackageJSON{
+		Name:         "project",
+		Version:      "1.0.0",
+		Dependencies: map[string]string{"app-lib": "1.0.0", "shared": "1.0.0"},
+	}
+
+	dir := t.TempDir()
+	result, err := inst.Install(context.Background(), pkg, Options{Dir: dir, UseCache: true})
+	require.NoError(t, err)
+
+	var paths []string
+	for _, placement := range result.Layout.Placements {
+		paths = append(paths, placement.Path+"="+placement.Node.Version)
+	}
+	assert.Equal(t, []string{
+		"node_modules/app-lib=1.0.0",
+		"node_modules/app-lib/node_modules/shared=2.0.0",
+		"node_modules/shared=1.0.0",
+	}, paths)
+
+	manifest := func(p string) map[string]interface{} {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(p), "package.json"))
+		require.NoError(t, err)
+		var m map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &m))
+		return m
+	}
+	assert.Equal(t, "1.0.0", manifest("node_modules/shared")["version"])
+	assert.Equal(t, "2.0.0", manifest("node_modules/app-lib/node_modules/shared")["version"])
+	assert.Equal(t, "app-lib", manifest("node_modules/app-lib")["name"])
+}
+
+func TestPlanLayoutShadowing(t *testing.T) {
+	node := func(name, version string, deps map[string]string) *Node {
+		if deps == nil {
+			deps = map[string]string{}
+		}
+		return &Node{Name: name, Version: version, Dependencies: deps}
+	}
+
+	// x needs c@2 while the top level holds c@1; b lives under x and needs
+	// c@1, which is shadowed by x's copy of c@2
+	graph := &Graph{
+		Root: map[string]string{"x": "1.0.0", "b": "2.0.0", "c": "1.0.0"},
+		Nodes: map[string]*Node{
+			"x@1.0.0": node("x", "1.0.0", map[string]string{"b": "1.0.0", "c": "2.0.0"}),
+			"b@1.0.0": node("b", "1.0.0", map[string]string{"c": "1.0.0"}),
+			"b@2.0.0": node("b", "2.0.0", nil),
+			"c@1.0.0": node("c", "1.0.0", nil),
+			"c@2.0.0": node("c", "2.0.0", nil),
+		},
+	}
+
+	var paths []string
+	for _, placement := range planHoisted(graph).Placements {
+		paths = append(paths, placement.Path+"="+placement.Node.Version)
+	}
+	assert.Equal(t, []string{
+		"node_modules/b=2.0.0",
+		"node_modules/c=1.0.0",
+		"node_modules/x=1.0.0",
+		"node_modules/x/node_modules/b=1.0.0",
+		"node_modules/x/node_modules/b/node_modules/c=1.0.0",
+		"node_modules/x/node_modules/c=2.0.0",
+	}, paths)
+}
+
+func TestPlanHoistedPlacesAsHighAsPossible(t *testing.T) {
+	node := func(name, version string, deps map[string]string) *Node {
+		if deps == nil {
+			deps = map[string]string{}
+		}
+		return &Node{Name: name, Version: version, Dependencies: deps}
+	}
+
+	// a nests b@1 because the top level holds b@2. b@1 needs e@1, which
+	// cannot go to the top (e@2 is there) but fits beside b under a, and
+	// c@1, which it finds at the top. y@1 also lives under a and needs c@3;
+	// putting that under a would shadow the c@1 that b@1 relies on, so it
+	// stays nested under y.
+	graph := &Graph{
+		Root: map[string]string{"a": "1.0.0", "b": "2.0.0", "c": "1.0.0", "e": "2.0.0", "y": "2.0.0"},
+		Nodes: map[string]*Node{
+			"a@1.0.0": node("a", "1.0.0", map[string]string{"b": "1.0.0", "y": "1.0.0"}),
+			"b@1.0.0": node("b", "1.0.0", map[string]string{"c": "1.0.0", "e": "1.0.0"}),
+			"b@2.0.0": node("b", "2.0.0", nil),
+			"c@1.0.0": node("c", "1.0.0", nil),
+			"c@3.0.0": node("c", "3.0.0", nil),
+			"e@1.0.0": node("e", "1.0.0", nil),
+			"e@2.0.0": node("e", "2.0.0", nil),
+			"y@1.0.0": node("y", "1.0.0", map[string]string{"c": "3.0.0"}),
+			"y@2.0.0": node("y", "2.0.0", map[string]string{"c": "1.0.0"}),
+		},
+	}
+
+	layout := planHoisted(graph)
+
+	var paths []string
+	for _, placement := range layout.Placements {
+		paths = append(paths, placement.Path+"="+placement.Node.Version)
+	}
+	assert.Equal(t, []string{
+		"node_modules/a=1.0.0",
+		"node_modules/a/node_modules/b=1.0.0",
+		"node_modules/a/node_modules/e=1.0.0",
+		"node_modules/a/node_modules/y=1.0.0",
+		"node_modules/a/node_modules/y/node_modules/c=3.0.0",
+		"node_modules/b=2.0.0",
+		"node_modules/c=1.0.0",
+		"node_modules/e=2.0.0",
+		"node_modules/y=2.0.0",
+	}, paths)
+
+	var report []string
+	for _, nested := range layout.Nested {
+		report = append(report, nested.String())
+	}
+	assert.Equal(t, []string{
+		"b@1.0.0 at node_modules/a/node_modules/b (required by a@1.0.0): node_modules/b holds b@2.0.0",
+		"e@1.0.0 at node_modules/a/node_modules/e (required by b@1.0.0): node_modules/e holds e@2.0.0",
+		"y@1.0.0 at node_modules/a/node_modules/y (required by a@1.0.0): node_modules/y holds y@2.0.0",
+		"c@3.0.0 at node_modules/a/node_modules/y/node_modules/c (required by y@1.0.0): node_modules/a/node_modules/b relies on c@1.0.0 at node_modules/c",
+	}, report)
+
+	// The same graph always produces the same tree
+	assert.Equal(t, layout, planHoisted(graph))
+}
+
+func TestInstallWritesAndHonorsLockfile(t *testing.T) {
+	mr := newMockRegistry(
+		mockPackage{name: "app-lib", version: "1.0.0", deps: map[string]string{"leaf": "^1.0.0"}},
+		mockPackage{name: "leaf", version: "1.0.0"},
+		mockPackage{name: "tool", version: "1.0.0"},
+		mockPackage{name: "tool", version: "2.0.0"},
+	)
+	defer mr.server.Close()
+
+	dir := t.TempDir()
+	pkg := &parser.PackageJSON{
+		Name:         "project",
+		Version:      "1.0.0",
+		Dependencies: map[string]string{"app-lib": "^1.0.0", "tool": "1.0.0"},
+	}
+
+	result, err := setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true})
+	require.NoError(t, err)
+	assert.True(t, result.LockfileWritten)
+
+	lock, err := lockfile.Read(filepath.Join(dir, lockfile.FileName))
+	require.NoError(t, err)
+	assert.Equal(t, lockfile.Dependency{Specifier: "^1.0.0", Version: "1.0.0"}, lock.Dependencies["app-lib"])
+	assert.Equal(t, map[string]string{"leaf": "1.0.0"}, lock.Packages["app-lib@1.0.0"].Dependencies)
+	assert.Contains(t, lock.Packages["leaf@1.0.0"].Integrity, "sha1-")
+	assert.Equal(t, mr.server.URL+"/leaf/-/1.0.0.tgz", lock.Packages["leaf@1.0.0"].Resolved)
+
+	// A newer leaf is published, but the lock keeps the install reproducible
+	// without consulting the registry metadata at all
+	mr.packages["leaf"] = append(mr.packages["leaf"], mockPackage{name: "leaf", version: "1.5.0"})
+	mr.tarballs["leaf@1.5.0"] = buildTarball(mockPackage{name: "leaf", version: "1.5.0"})
+	mr.metadata = make(map[string]int)
+
+	result, err = setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true})
+	require.NoError(t, err)
+	assert.False(t, result.LockfileWritten)
+	assert.Empty(t, mr.metadata)
+	assert.Contains(t, result.Graph.Nodes, "leaf@1.0.0")
+
+	// Changing one specifier resolves the graph again, but unchanged
+	// dependencies keep their locked versions
+	pkg.Dependencies["tool"] = "^2.0.0"
+	result, err = setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true})
+	require.NoError(t, err)
+	assert.True(t, result.LockfileWritten)
+	assert.Equal(t, map[string]string{"app-lib": "1.0.0", "tool": "2.0.0"}, result.Graph.Root)
+	assert.Contains(t, result.Graph.Nodes, "leaf@1.0.0")
+	assert.NotContains(t, result.Graph.Nodes, "leaf@1.5.0")
+
+	lock, err = lockfile.Read(filepath.Join(dir, lockfile.FileName))
+	require.NoError(t, err)
+	assert.NotContains(t, lock.Packages, "tool@1.0.0")
+	assert.Contains(t, lock.Packages, "tool@2.0.0")
+}
+
+func TestProjectDependencies(t *testing.T) {
+	pkg := &parser.PackageJSON{
+		Dependencies:    map[string]string{"a": "1.0.0", "b": "^2.0.0"},
+		DevDependencies: map[string]string{"b": "^1.0.0", "c": "3.0.0"},
+	}
+
+	deps := ProjectDependencies(pkg)
+	assert.Equal(t, map[string]string{"a": "1.0.0", "b": "^2.0.0", "c": "3.0.0"}, deps)
+}
+
+func TestInstallIsolatedLinker(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on windows")
+	}
+
+	mr := newMockRegistry(
+		mockPackage{name: "app-lib", version: "1.0.0", deps: map[string]string{"shared": "^2.0.0"}},
+		mockPackage{name: "shared", version: "1.0.0"},
+		mockPackage{name: "shared", version: "2.0.0", deps: map[string]string{"hidden": "1.0.0"}},
+		mockPackage{name: "hidden", version: "1.0.0"},
+	)
+	defer mr.server.Close()
+
+	dir := t.TempDir()
+	pkg := &parser.PackageJSON{
+		Name:         "project",
+		Version:      "1.0.0",
+		Dependencies: map[string]string{"app-lib": "1.0.0", "shared": "1.0.0"},
+		Zap:          &parser.ZapConfig{Linker: LinkerIsolated},
+	}
+
+	result, err := setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true})
+	require.NoError(t, err)
+	assert.Len(t, result.Layout.Placements, 4)
+
+	version := func(p string) string {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(p), "package.json"))
+		require.NoError(t, err)
+		var m map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &m))
+		return m["version"].(string)
+	}
+
+	// Direct dependencies are symlinks into node_modules/.zap
+	info, err := os.Lstat(filepath.Join(dir, "node_modules", "app-lib"))
+	require.NoError(t, err)
+	assert.True(t, info.Mode()&os.ModeSymlink != 0)
+	assert.Equal(t, "1.0.0", version("node_modules/shared"))
+	assert.FileExists(t, filepath.Join(dir, "node_modules", ".zap", "app-lib@1.0.0", "node_modules", "app-lib", "package.json"))
+
+	// Each package sees exactly its own dependencies
+	assert.Equal(t, "2.0.0", version("node_modules/.zap/app-lib@1.0.0/node_modules/shared"))
+	assert.Equal(t, "1.0.0", version("node_modules/.zap/shared@2.0.0/node_modules/hidden"))
+
+	// Transitive dependencies are not reachable from the project root
+	_, err = os.Lstat(filepath.Join(dir, "node_modules", "hidden"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSwitchingLinkersPrunesNodeModules(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on windows")
+	}
+
+	mr := newMockRegistry(
+		mockPackage{name: "app-lib", version: "1.0.0", deps: map[string]string{"hidden": "1.0.0"}},
+		mockPackage{name: "hidden", version: "1.0.0"},
+	)
+	defer mr.server.Close()
+
+	dir := t.TempDir()
+	pkg := &parser.PackageJSON{
+		Name:         "project",
+		Version:      "1.0.0",
+		Dependencies: map[string]string{"app-lib": "1.0.0"},
+	}
+	inst := setupInstaller(t, mr)
+
+	// Files of other tools are left alone
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "node_modules", ".cache"), 0755))
+
+	_, err := inst.Install(context.Background(), pkg, Options{Dir: dir, UseCache: true, Linker: LinkerHoisted})
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, "node_modules", "hidden", "package.json"))
+
+	// The hoisted transitive package must not stay resolvable
+	_, err = inst.Install(context.Background(), pkg, Options{Dir: dir, UseCache: true, Linker: LinkerIsolated})
+	require.NoError(t, err)
+	_, err = os.Lstat(filepath.Join(dir, "node_modules", "hidden"))
+	assert.True(t, os.IsNotExist(err))
+	assert.FileExists(t, filepath.Join(dir, "node_modules", "app-lib", "package.json"))
+
+	// Going back drops the isolated store
+	_, err = inst.Install(context.Background(), pkg, Options{Dir: dir, UseCache: true, Linker: LinkerHoisted})
+	require.NoError(t, err)
+	assert.NoDirExists(t, filepath.Join(dir, "node_modules", ".zap"))
+	assert.FileExists(t, filepath.Join(dir, "node_modules", "hidden", "package.json"))
+	assert.DirExists(t, filepath.Join(dir, "node_modules", ".cache"))
+}
+
+func TestInstallRemovesDroppedDependencies(t *testing.T) {
+	mr := newMockRegistry(
+		mockPackage{name: "kept", version: "1.0.0"},
+		mockPackage{name: "@scope/dropped", version: "1.0.0"},
+	)
+	defer mr.server.Close()
+
+	dir := t.TempDir()
+	inst := setupInstaller(t, mr)
+	pkg := &parser.PackageJSON{
+		Name:         "project",
+		Version:      "1.0.0",
+		Dependencies: map[string]string{"kept": "1.0.0", "@scope/dropped": "1.0.0"},
+	}
+	_, err := inst.Install(context.Background(), pkg, Options{Dir: dir, UseCache: true})
+	require.NoError(t, err)
+	assert.DirExists(t, filepath.Join(dir, "node_modules", "@scope", "dropped"))
+
+	delete(pkg.Dependencies, "@scope/dropped")
+	_, err = inst.Install(context.Background(), pkg, Options{Dir: dir, UseCache: true})
+	require.NoError(t, err)
+	assert.NoDirExists(t, filepath.Join(dir, "node_modules", "@scope"))
+	assert.DirExists(t, filepath.Join(dir, "node_modules", "kept"))
+}
+
+func TestInstallUnknownLinker(t *testing.T) {
+	mr := newMockRegistry(mockPackage{name: "leaf", version: "1.0.0"})
+	defer mr.server.Close()
+
+	pkg := &parser.PackageJSON{
+		Name:         "project",
+		Version:      "1.0.0",
+		Dependencies: map[string]string{"leaf": "1.0.0"},
+	}
+
+	_, err := setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: t.TempDir(), Linker: "pnp"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown linker "pnp"`)
+}
+
+func TestPlanIsolatedScopedNames(t *testing.T) {
+	graph := &Graph{
+		Root: map[string]string{"@scope/lib": "1.0.0"},
+		Nodes: map[string]*Node{
+			"@scope/lib@1.0.0":  {Name: "@scope/lib", Version: "1.0.0", Dependencies: map[string]string{"@scope/util": "2.0.0"}},
+			"@scope/util@2.0.0": {Name: "@scope/util", Version: "2.0.0", Dependencies: map[string]string{}},
+		},
+	}
+
+	layout := planIsolated(graph)
+
+	var placements []string
+	for _, placement := range layout.Placements {
+		placements = append(placements, placement.Path)
+	}
+	assert.Equal(t, []string{
+		"node_modules/.zap/@scope+lib@1.0.0/node_modules/@scope/lib",
+		"node_modules/.zap/@scope+util@2.0.0/node_modules/@scope/util",
+	}, placements)
+
+	assert.Equal(t, []Symlink{
+		{Path: "node_modules/.zap/@scope+lib@1.0.0/node_modules/@scope/util", Target: "node_modules/.zap/@scope+util@2.0.0/node_modules/@scope/util"},
+		{Path: "node_modules/@scope/lib", Target: "node_modules/.zap/@scope+lib@1.0.0/node_modules/@scope/lib"},
+	}, layout.Symlinks)
+}
+
+func TestInstallScopedPackages(t *testing.T) {
+	mr := newMockRegistry(
+		mockPackage{name: "@scope/lib", version: "1.0.0", deps: map[string]string{"@scope/util": "^2.0.0", "leaf": "1.0.0"}},
+		mockPackage{name: "@scope/util", version: "2.0.0"},
+		mockPackage{name: "leaf", version: "1.0.0", deps: map[string]string{"@scope/util": "2.0.0"}},
+	)
+	defer mr.server.Close()
+
+	dir := t.TempDir()
+	pkg := &parser.PackageJSON{
+		Name:         "project",
+		Version:      "1.0.0",
+		Dependencies: map[string]string{"@scope/lib": "^1.0.0"},
+	}
+
+	result, err := setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"@scope/lib": "1.0.0"}, result.Graph.Root)
+	assert.Contains(t, result.Graph.Nodes, "@scope/util@2.0.0")
+
+	// Scoped tarballs are cached below a directory per scope
+	for _, download := range result.Downloads {
+		if download.PackageName == "@scope/util" {
+			assert.True(t, strings.HasSuffix(filepath.ToSlash(download.Path), "/@scope/util/2.0.0/package.tgz"), download.Path)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "node_modules", "@scope", "util", "package.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"name":"@scope/util"`)
+	assert.FileExists(t, filepath.Join(dir, "node_modules", "@scope", "lib", "package.json"))
+
+	lock, err := lockfile.Read(filepath.Join(dir, lockfile.FileName))
+	require.NoError(t, err)
+	assert.Equal(t, lockfile.Dependency{Specifier: "^1.0.0", Version: "1.0.0"}, lock.Dependencies["@scope/lib"])
+	assert.Equal(t, map[string]string{"@scope/util": "2.0.0", "leaf": "1.0.0"}, lock.Packages["@scope/lib@1.0.0"].Dependencies)
+	assert.Equal(t, mr.server.URL+"/@scope/util/-/2.0.0.tgz", lock.Packages["@scope/util@2.0.0"].Resolved)
+
+	// Reinstalling from the lock file works for scoped names as well
+	_, err = setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true, FrozenLockfile: true})
+	require.NoError(t, err)
+}
+
+func TestInstallRejectsPathTraversalNames(t *testing.T) {
+	mr := newMockRegistry(
+		mockPackage{name: "app-lib", version: "1.0.0", deps: map[string]string{"leaf": "^1.0.0"}},
+		mockPackage{name: "leaf", version: "1.0.0"},
+		mockPackage{name: "evil-lib", version: "1.0.0", deps: map[string]string{"../../evil": "1.0.0"}},
+	)
+	defer mr.server.Close()
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "project")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	escaped := filepath.Join(root, "evil")
+
+	// A name published in a packument
+	pkg := &parser.PackageJSON{
+		Name:         "project",
+		Version:      "1.0.0",
+		Dependencies: map[string]string{"evil-lib": "1.0.0"},
+	}
+	_, err := setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid package name "../../evil"`)
+	assert.NotContains(t, mr.metadata, "../../evil")
+	assert.NoDirExists(t, filepath.Join(dir, "node_modules"))
+	assert.NoFileExists(t, escaped)
+
+	// A name planted in the lock file
+	pkg.Dependencies = map[string]string{"app-lib": "1.0.0"}
+	_, err = setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true})
+	require.NoError(t, err)
+
+	lockPath := filepath.Join(dir, lockfile.FileName)
+	lock, err := lockfile.Read(lockPath)
+	require.NoError(t, err)
+	leaf := lock.Packages["leaf@1.0.0"]
+	delete(lock.Packages, "leaf@1.0.0")
+	leaf.Name = "../../evil"
+	lock.Packages["../../evil@1.0.0"] = leaf
+	lock.Packages["app-lib@1.0.0"].Dependencies = map[string]string{"../../evil": "1.0.0"}
+	data, err := lock.Marshal()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(lockPath, data, 0644))
+
+	_, err = setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true, FrozenLockfile: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid package name "../../evil"`)
+
+	// Without --frozen-lockfile the lock is ignored and resolved again
+	result, err := setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true})
+	require.NoError(t, err)
+	assert.Contains(t, result.Graph.Nodes, "leaf@1.0.0")
+	assert.NoFileExists(t, escaped)
+	assert.NoDirExists(t, escaped)
+}
+
+func TestInstallResolvesChangesAgainstLockedPackages(t *testing.T) {
+	mr := newMockRegistry(
+		mockPackage{name: "a", version: "1.0.0", deps: map[string]string{"c": "^1.0.0"}},
+		mockPackage{name: "b", version: "1.0.0", deps: map[string]string{"c": "*"}},
+		mockPackage{name: "c", version: "1.0.0"},
+		mockPackage{name: "c", version: "2.0.0"},
+	)
+	defer mr.server.Close()
+
+	dir := t.TempDir()
+	pkg := &parser.PackageJSON{
+		Name:         "project",
+		Version:      "1.0.0",
+		Dependencies: map[string]string{"a": "^1.0.0"},
+		Zap:          &parser.ZapConfig{SingleVersion: true},
+	}
+	_, err := setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true})
+	require.NoError(t, err)
+
+	// b would take c@2.0.0 on its own, but the single version constraint
+	// includes the c locked for a
+	pkg.Dependencies["b"] = "^1.0.0"
+	result, err := setupInstaller(t, mr).Install(context.Background(), pkg, Options{Dir: dir, UseCache: true})
+	require.NoError(t, err)
+
+	var keys []string
+	for _, node := range result.Graph.Sorted() {
+		keys = append(keys, node.Key())
+	}
+	assert.Equal(t, []string{"a@1.0.0", "b@1.0.0", "c@1.0.0"}, keys)
+	assert.Equal(t, "1.0.0", result.Graph.Nodes["b@1.0.0"].Dependencies["c"])
+}
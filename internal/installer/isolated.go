@@ -0,0 +1,57 @@
+package installer
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	isolatedStoreDir = ".zap"
+)
+
+// planIsolated gives every package its own directory under
+// node_modules/.zap/<name>@<version>/node_modules/<name>. The dependencies
+// of a package are symlinked next to it, and only the project's direct
+// dependencies are linked into the top level node_modules, so code can
+// never require a package it did not declare.
+func planIsolated(graph *Graph) *Layout {
+	layout := &Layout{}
+
+	for _, node := range graph.Sorted() {
+		layout.Placements = append(layout.Placements, Placement{
+			Path: isolatedPath(node.Name, node.Version),
+			Node: node,
+		})
+
+		for _, name := range sortedKeys(node.Dependencies) {
+			layout.Symlinks = append(layout.Symlinks, Symlink{
+				Path:   path.Join(isolatedDir(node.Name, node.Version), nodeModulesDir, name),
+				Target: isolatedPath(name, node.Dependencies[name]),
+			})
+		}
+	}
+
+	for _, name := range sortedKeys(graph.Root) {
+		layout.Symlinks = append(layout.Symlinks, Symlink{
+			Path:   path.Join(nodeModulesDir, name),
+			Target: isolatedPath(name, graph.Root[name]),
+		})
+	}
+
+	sort.Slice(layout.Symlinks, func(i, j int) bool {
+		return layout.Symlinks[i].Path < layout.Symlinks[j].Path
+	})
+	return layout
+}
+
+// isolatedDir returns the private directory of a package version. Scoped
+// names are flattened so every version is a direct child of .zap.
+func isolatedDir(name, version string) string {
+	return path.Join(nodeModulesDir, isolatedStoreDir, strings.ReplaceAll(name, "/", "+")+"@"+version)
+}
+
+// isolatedPath returns where the files of a package version live
+func isolatedPath(name, version string) string {
+	return path.Join(isolatedDir(name, version), nodeModulesDir, name)
+}
@@ -0,0 +1,88 @@
+package installer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	nodeModulesDir = "node_modules"
+)
+
+// Supported node_modules layouts
+const (
+	// LinkerHoisted lays packages out like npm, as flat as possible
+	LinkerHoisted = "hoisted"
+
+	// LinkerIsolated keeps every package in node_modules/.zap and exposes
+	// only declared dependencies through symlinks
+	LinkerIsolated = "isolated"
+)
+
+// Placement positions a package inside the node_modules tree
+type Placement struct {
+	Path string // slash separated, relative to the project directory
+	Node *Node
+}
+
+// Symlink is a link created inside the node_modules tree
+type Symlink struct {
+	Path   string // slash separated, relative to the project directory
+	Target string // slash separated, relative to the project directory
+}
+
+// Layout describes where every package of a graph goes inside node_modules
+type Layout struct {
+	Placements []Placement
+	Symlinks   []Symlink
+	Nested     []NestedPackage // hoisted linker only: packages kept out of the top level
+}
+
+// planLayout lays the graph out with the given linker
+func planLayout(linker string, graph *Graph) (*Layout, error) {
+	switch linker {
+	case "", LinkerHoisted:
+		return planHoisted(graph), nil
+	case LinkerIsolated:
+		return planIsolated(graph), nil
+	default:
+		return nil, fmt.Errorf("unknown linker %q (expected %s or %s)", linker, LinkerHoisted, LinkerIsolated)
+	}
+}
+
+// topLevel returns the entries of the project's node_modules the layout
+// occupies, relative to it: package names, with scoped names as
+// "@scope/name", and the children of .zap as ".zap/<dir>"
+func (l *Layout) topLevel() map[string]bool {
+	entries := make(map[string]bool)
+	add := func(p string) {
+		rest, ok := strings.CutPrefix(p, nodeModulesDir+"/")
+		if !ok {
+			return
+		}
+		parts := strings.SplitN(rest, "/", 3)
+		if len(parts) >= 2 && (parts[0] == isolatedStoreDir || strings.HasPrefix(parts[0], "@")) {
+			entries[parts[0]+"/"+parts[1]] = true
+			return
+		}
+		entries[parts[0]] = true
+	}
+
+	for _, placement := range l.Placements {
+		add(placement.Path)
+	}
+	for _, symlink := range l.Symlinks {
+		add(symlink.Path)
+	}
+	return entries
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
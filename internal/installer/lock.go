@@ -0,0 +1,126 @@
+package installer
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/marpit19/zap-pm/internal/lockfile"
+	"github.com/marpit19/zap-pm/internal/registry"
+)
+
+// lockFromGraph records a resolved graph together with the specifiers it
+// was resolved from
+func lockFromGraph(graph *Graph, deps map[string]string) *lockfile.Lockfile {
+	lock := lockfile.New()
+
+	for name, version := range graph.Root {
+		lock.Dependencies[name] = lockfile.Dependency{
+			Specifier: deps[name],
+			Version:   version,
+		}
+	}
+
+	for key, node := range graph.Nodes {
+		var nodeDeps map[string]string
+		if len(node.Dependencies) > 0 {
+			nodeDeps = make(map[string]string, len(node.Dependencies))
+			for name, version := range node.Dependencies {
+				nodeDeps[name] = version
+			}
+		}
+
+		lock.Packages[key] = &lockfile.Package{
+			Name:         node.Name,
+			Version:      node.Version,
+			Resolved:     node.Dist.Tarball,
+			Integrity:    lockIntegrity(node.Dist),
+			Dependencies: nodeDeps,
+		}
+	}
+
+	return lock
+}
+
+// graphFromLock rebuilds the part of the graph reachable from direct
+// dependencies whose specifier is unchanged since the lock was written.
+// Dependencies that are new or changed are returned for resolution.
+func graphFromLock(lock *lockfile.Lockfile, deps map[string]string) (*Graph, map[string]string) {
+	roots := make(map[string]string)
+	unresolved := make(map[string]string)
+
+	for name, spec := range deps {
+		locked, ok := lock.Dependencies[name]
+		if !ok || locked.Specifier != spec {
+			unresolved[name] = spec
+			continue
+		}
+		roots[name] = locked.Version
+	}
+
+	return walkLock(lock, roots), unresolved
+}
+
+// walkLock collects every locked package reachable from roots, a map of
+// direct dependency names to locked versions
+func walkLock(lock *lockfile.Lockfile, roots map[string]string) *Graph {
+	graph := &Graph{
+		Root:  make(map[string]string),
+		Nodes: make(map[string]*Node),
+	}
+
+	var queue []string
+	for name, version := range roots {
+		graph.Root[name] = version
+		queue = append(queue, lockfile.Key(name, version))
+	}
+
+	for len(queue) > 0 {
+		key := queue[0]
+		queue = queue[1:]
+		if _, seen := graph.Nodes[key]; seen {
+			continue
+		}
+
+		pkg := lock.Packages[key]
+		node := &Node{
+			Name:    pkg.Name,
+			Version: pkg.Version,
+			Dist: registry.Dist{
+				Tarball:   pkg.Resolved,
+				Integrity: pkg.Integrity,
+			},
+			Dependencies: make(map[string]string, len(pkg.Dependencies)),
+		}
+		for name, version := range pkg.Dependencies {
+			node.Dependencies[name] = version
+			queue = append(queue, lockfile.Key(name, version))
+		}
+		graph.Nodes[key] = node
+	}
+
+	return graph
+}
+
+// lockedVersions lists the versions of every package in a graph rebuilt
+// from the lock file, for the resolver to prefer
+func lockedVersions(graph *Graph) map[string][]string {
+	versions := make(map[string][]string)
+	for _, node := range graph.Nodes {
+		versions[node.Name] = append(versions[node.Name], node.Version)
+	}
+	return versions
+}
+
+// lockIntegrity returns the SRI string recorded for dist, converting the
+// legacy hex shasum when the registry publishes no integrity
+func lockIntegrity(dist registry.Dist) string {
+	if dist.Integrity != "" {
+		return dist.Integrity
+	}
+
+	raw, err := hex.DecodeString(dist.Shasum)
+	if err != nil || len(raw) == 0 {
+		return ""
+	}
+	return "sha1-" + base64.StdEncoding.EncodeToString(raw)
+}
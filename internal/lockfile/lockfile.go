@@ -0,0 +1,155 @@
+package lockfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/marpit19/zap-pm/internal/errors"
+	"github.com/marpit19/zap-pm/internal/fsutil"
+	"github.com/marpit19/zap-pm/internal/registry"
+)
+
+const (
+	// FileName is the name of the lock file in the project directory
+	FileName = "zap-lock.json"
+
+	// Version is the lock file format version written by this release
+	Version = 1
+)
+
+// Common error types
+const (
+	ErrLockfileNotFound  = "lock file not found"
+	ErrInvalidLockfile   = "invalid lock file"
+	ErrLockfileOutOfSync = "lock file out of sync"
+)
+
+// Lockfile records the exact result of a dependency resolution
+type Lockfile struct {
+	LockfileVersion int                   `json:"lockfileVersion"`
+	Dependencies    map[string]Dependency `json:"dependencies"`
+	Packages        map[string]*Package   `json:"packages"`
+}
+
+// Dependency is a direct dependency of the project
+type Dependency struct {
+	Specifier string `json:"specifier"`
+	Version   string `json:"version"`
+}
+
+// Package is a single resolved package, keyed by name@version
+type Package struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	Resolved     string            `json:"resolved"`
+	Integrity    string            `json:"integrity"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+// New creates an empty lock file
+func New() *Lockfile {
+	return &Lockfile{
+		LockfileVersion: Version,
+		Dependencies:    make(map[string]Dependency),
+		Packages:        make(map[string]*Package),
+	}
+}
+
+// Key returns the identifier a package is stored under
+func Key(name, version string) string {
+	return name + "@" + version
+}
+
+// Read loads and validates a lock file
+func Read(filename string) (*Lockfile, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.New(ErrLockfileNotFound, "failed to read lock file", err)
+	}
+
+	var lock Lockfile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, errors.New(ErrInvalidLockfile, "failed to parse lock file", err)
+	}
+
+	if err := lock.Validate(); err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// Validate checks that the lock file is complete and self consistent
+func (l *Lockfile) Validate() error {
+	if l.LockfileVersion != Version {
+		return errors.New(ErrInvalidLockfile, fmt.Sprintf("unsupported lockfileVersion %d", l.LockfileVersion), nil)
+	}
+
+	// Names and versions become paths in node_modules and the caches
+	for name := range l.Dependencies {
+		if err := registry.ValidateName(name); err != nil {
+			return errors.New(ErrInvalidLockfile, err.Error(), nil)
+		}
+	}
+	for key, pkg := range l.Packages {
+		if err := registry.ValidatePackage(pkg.Name, pkg.Version); err != nil {
+			return errors.New(ErrInvalidLockfile, fmt.Sprintf("entry %s: %v", key, err), nil)
+		}
+	}
+
+	for name, dep := range l.Dependencies {
+		if _, ok := l.Packages[Key(name, dep.Version)]; !ok {
+			return errors.New(ErrInvalidLockfile, fmt.Sprintf("missing entry for dependency %s", Key(name, dep.Version)), nil)
+		}
+	}
+
+	for key, pkg := range l.Packages {
+		if key != Key(pkg.Name, pkg.Version) {
+			return errors.New(ErrInvalidLockfile, fmt.Sprintf("entry %s does not match %s", key, Key(pkg.Name, pkg.Version)), nil)
+		}
+		if pkg.Resolved == "" || pkg.Integrity == "" {
+			return errors.New(ErrInvalidLockfile, fmt.Sprintf("entry %s is missing resolved or integrity", key), nil)
+		}
+		for name, version := range pkg.Dependencies {
+			if _, ok := l.Packages[Key(name, version)]; !ok {
+				return errors.New(ErrInvalidLockfile, fmt.Sprintf("missing entry for %s required by %s", Key(name, version), key), nil)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Marshal serializes the lock file. Map keys are always emitted in sorted
+// order, so identical resolutions produce byte identical files.
+func (l *Lockfile) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(l); err != nil {
+		return nil, errors.New(ErrInvalidLockfile, "failed to marshal lock file", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteToFile writes the lock file atomically, leaving it untouched when the content
+// did not change. It reports whether the file was written.
+func (l *Lockfile) WriteToFile(filename string) (bool, error) {
+	data, err := l.Marshal()
+	if err != nil {
+		return false, err
+	}
+
+	if existing, err := os.ReadFile(filename); err == nil && bytes.Equal(existing, data) {
+		return false, nil
+	}
+
+	// Written through a temporary file, so an interrupted install never
+	// leaves a truncated lock file behind
+	if err := fsutil.WriteFile(filename, data, 0644); err != nil {
+		return false, errors.New(ErrInvalidLockfile, "failed to write lock file", err)
+	}
+	return true, nil
+}
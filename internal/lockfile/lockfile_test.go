@@ -0,0 +1,158 @@
+package lockfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleLockfile() *Lockfile {
+	lock := New()
+	lock.Dependencies["zeta"] = Dependency{Specifier: "^1.0.0", Version: "1.2.0"}
+	lock.Dependencies["alpha"] = Dependency{Specifier: "2.0.0", Version: "2.0.0"}
+	lock.Packages["zeta@1.2.0"] = &Package{
+		Name:         "zeta",
+		Version:      "1.2.0",
+		Resolved:     "https://registry.npmjs.org/zeta/-/zeta-1.2.0.tgz",
+		Integrity:    "sha1-AAAA",
+		Dependencies: map[string]string{"omega": "1.0.0", "beta": "1.0.0"},
+	}
+	lock.Packages["alpha@2.0.0"] = &Package{
+		Name:      "alpha",
+		Version:   "2.0.0",
+		Resolved:  "https://registry.npmjs.org/alpha/-/alpha-2.0.0.tgz",
+		Integrity: "sha1-BBBB",
+	}
+	lock.Packages["beta@1.0.0"] = &Package{
+		Name:      "beta",
+		Version:   "1.0.0",
+		Resolved:  "https://registry.npmjs.org/beta/-/beta-1.0.0.tgz",
+		Integrity: "sha1-CCCC",
+	}
+	lock.Packages["omega@1.0.0"] = &Package{
+		Name:      "omega",
+		Version:   "1.0.0",
+		Resolved:  "https://registry.npmjs.org/omega/-/omega-1.0.0.tgz",
+		Integrity: "sha1-DDDD",
+	}
+	return lock
+}
+
+func TestMarshalIsSortedAndStable(t *testing.T) {
+	first, err := sampleLockfile().Marshal()
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		again, err := sampleLockfile().Marshal()
+		require.NoError(t, err)
+		assert.Equal(t, string(first), string(again))
+	}
+
+	out := string(first)
+	assert.Less(t, strings.Index(out, `"alpha"`), strings.Index(out, `"zeta"`))
+	assert.Less(t, strings.Index(out, `"alpha@2.0.0"`), strings.Index(out, `"beta@1.0.0"`))
+	assert.Less(t, strings.Index(out, `"beta": "1.0.0"`), strings.Index(out, `"omega": "1.0.0"`))
+	assert.Equal(t, byte('\n'), first[len(first)-1])
+}
+
+func TestWriteAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	lock := sampleLockfile()
+
+	written, err := lock.WriteToFile(path)
+	require.NoError(t, err)
+	assert.True(t, written)
+
+	// Writing the same content again leaves the file alone
+	written, err = lock.WriteToFile(path)
+	require.NoError(t, err)
+	assert.False(t, written)
+
+	// The temporary file the lock is written through is gone
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	parsed, err := Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, lock, parsed)
+}
+
+func TestReadInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		mutate   func(*Lockfile)
+		content  string
+		expected string
+	}{
+		{
+			name:     "malformed json",
+			content:  "{not json",
+			expected: "failed to parse lock file",
+		},
+		{
+			name:     "unsupported version",
+			mutate:   func(l *Lockfile) { l.LockfileVersion = 99 },
+			expected: "unsupported lockfileVersion",
+		},
+		{
+			name:     "dangling dependency",
+			mutate:   func(l *Lockfile) { delete(l.Packages, "omega@1.0.0") },
+			expected: "missing entry for omega@1.0.0 required by zeta@1.2.0",
+		},
+		{
+			name:     "dangling root dependency",
+			mutate:   func(l *Lockfile) { delete(l.Packages, "alpha@2.0.0") },
+			expected: "missing entry for dependency alpha@2.0.0",
+		},
+		{
+			name:     "missing integrity",
+			mutate:   func(l *Lockfile) { l.Packages["beta@1.0.0"].Integrity = "" },
+			expected: "missing resolved or integrity",
+		},
+		{
+			name: "path traversal in a package name",
+			mutate: func(l *Lockfile) {
+				pkg := l.Packages["beta@1.0.0"]
+				pkg.Name = "../../beta"
+				delete(l.Packages, "beta@1.0.0")
+				l.Packages["../../beta@1.0.0"] = pkg
+			},
+			expected: `invalid package name "../../beta"`,
+		},
+		{
+			name:     "path traversal in a version",
+			mutate:   func(l *Lockfile) { l.Packages["beta@1.0.0"].Version = "../1.0.0" },
+			expected: `invalid version "../1.0.0"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), FileName)
+			if tt.content != "" {
+				require.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+			} else {
+				lock := sampleLockfile()
+				tt.mutate(lock)
+				data, err := lock.Marshal()
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(path, data, 0644))
+			}
+
+			_, err := Read(path)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expected)
+		})
+	}
+}
+
+func TestReadMissing(t *testing.T) {
+	_, err := Read(filepath.Join(t.TempDir(), FileName))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ErrLockfileNotFound)
+}
@@ -4,6 +4,7 @@ import "github.com/sirupsen/logrus"
 
 type Logger struct {
 	*logrus.Logger
+	redactor *redactor
 }
 
 // New creates a new logger instance
@@ -13,7 +14,16 @@ func New() *Logger {
 		FullTimestamp: true,
 	})
 
-	return &Logger{Logger: log}
+	redactor := &redactor{}
+	log.AddHook(redactor)
+
+	return &Logger{Logger: log, redactor: redactor}
+}
+
+// AddSecret masks every occurrence of secret in log messages, in addition
+// to the credentials that are recognized by their shape
+func (l *Logger) AddSecret(secret string) {
+	l.redactor.add(secret)
 }
 
 // Field represents a log fiels
@@ -29,5 +39,5 @@ func (l *Logger) WithFields(fields ...Field) *Logger {
 		logrusFields[field.Key] = field.Value
 	}
 
-	return &Logger{Logger: l.Logger.WithFields(logrusFields).Logger}
+	return &Logger{Logger: l.Logger.WithFields(logrusFields).Logger, redactor: l.redactor}
 }
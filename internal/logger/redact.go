@@ -0,0 +1,89 @@
+package logger
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const mask = "***"
+
+// credentialPatterns match credentials by their shape: Authorization
+// header values, .npmrc credential settings and passwords in URLs
+var credentialPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)\b(Bearer|Basic)\s+[A-Za-z0-9._~+/=-]+`), "$1 " + mask},
+	{regexp.MustCompile(`(_authToken|_auth|_password)(\s*[=:]\s*)[^\s"',;]+`), "${1}${2}" + mask},
+	{regexp.MustCompile(`(://[^/\s:@]+):[^/\s@]+@`), "$1:" + mask + "@"},
+}
+
+// Redact masks credentials recognized by their shape in s
+func Redact(s string) string {
+	for _, p := range credentialPatterns {
+		s = p.pattern.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// redactor is a logrus hook masking credentials in messages before they
+// are written
+type redactor struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+func (r *redactor) add(secret string) {
+	if secret == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.secrets = append(r.secrets, secret)
+}
+
+func (r *redactor) redact(s string) string {
+	r.mu.RLock()
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, mask)
+	}
+	r.mu.RUnlock()
+	return Redact(s)
+}
+
+// Levels implements logrus.Hook
+func (r *redactor) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook. Fields are masked too, since URLs and
+// header values are often logged through them.
+func (r *redactor) Fire(entry *logrus.Entry) error {
+	entry.Message = r.redact(entry.Message)
+
+	// The map may be shared with the entry the fields were added to
+	data := make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		data[key] = r.redactValue(value)
+	}
+	entry.Data = data
+	return nil
+}
+
+// redactValue masks a field value. Values other than strings, such as
+// URLs, errors or headers, are replaced by their masked text only when it
+// contains a credential, so formatters keep their type otherwise.
+func (r *redactor) redactValue(value interface{}) interface{} {
+	if s, ok := value.(string); ok {
+		return r.redact(s)
+	}
+	text := fmt.Sprint(value)
+	if masked := r.redact(text); masked != text {
+		return masked
+	}
+	return value
+}
@@ -0,0 +1,356 @@
+package npmrc
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultRegistry is the registry used when no configuration names one
+const DefaultRegistry = "https://registry.npmjs.org/"
+
+// envReference matches ${NAME} and ${NAME?} references, optionally escaped
+// with a backslash
+var envReference = regexp.MustCompile(`(\\*)\$\{([^${}?]+)(\?)?\}`)
+
+// Config is the merged configuration of every .npmrc file, with keys as
+// they appear in the files
+type Config struct {
+	values map[string]string
+	files  []string
+}
+
+// Credentials are the registry credentials configured for a URL
+type Credentials struct {
+	Token    string // bearer token (_authToken)
+	Username string
+	Password string // decoded from the base64 _password
+	Auth     string // base64 username:password (_auth)
+}
+
+// Empty reports whether no credential is set
+func (c *Credentials) Empty() bool {
+	return c.Token == "" && c.Auth == "" && (c.Username == "" || c.Password == "")
+}
+
+// New returns a configuration holding values, with no files behind it
+func New(values map[string]string) *Config {
+	cfg := &Config{values: make(map[string]string, len(values))}
+	for key, value := range values {
+		cfg.values[key] = value
+	}
+	return cfg
+}
+
+// Load reads the global, user and project .npmrc files followed by
+// npm_config_* environment variables. Later sources take precedence, as in
+// npm: environment, then project, then user, then global configuration.
+// Missing files are skipped.
+func Load(projectDir string) (*Config, error) {
+	cfg := New(nil)
+
+	for _, path := range configFiles(projectDir) {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if err := cfg.parse(strings.NewReader(string(data))); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		cfg.files = append(cfg.files, path)
+	}
+
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		lower := strings.ToLower(name)
+		if !strings.HasPrefix(lower, "npm_config_") || value == "" {
+			continue
+		}
+		key := strings.TrimPrefix(lower, "npm_config_")
+		// Only plain options can be set from the environment
+		if key == "userconfig" || key == "globalconfig" || strings.HasPrefix(key, "//") {
+			continue
+		}
+		cfg.values[strings.ReplaceAll(key, "_", "-")] = value
+	}
+	return cfg, nil
+}
+
+// configFiles lists the .npmrc files in increasing precedence
+func configFiles(projectDir string) []string {
+	var files []string
+
+	if global := os.Getenv("NPM_CONFIG_GLOBALCONFIG"); global != "" {
+		files = append(files, global)
+	} else {
+		prefix := os.Getenv("PREFIX")
+		if prefix == "" {
+			prefix = "/usr/local"
+		}
+		files = append(files, filepath.Join(prefix, "etc", "npmrc"))
+	}
+
+	if user := os.Getenv("NPM_CONFIG_USERCONFIG"); user != "" {
+		files = append(files, user)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".npmrc"))
+	}
+
+	if projectDir != "" {
+		project := filepath.Join(projectDir, ".npmrc")
+		// The project file may be the user file when installing from home
+		if len(files) == 0 || files[len(files)-1] != project {
+			files = append(files, project)
+		}
+	}
+	return files
+}
+
+// Parse reads a single .npmrc document
+func Parse(r io.Reader) (*Config, error) {
+	cfg := New(nil)
+	if err := cfg.parse(r); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// parse merges an ini style document into the configuration. Keys and
+// values may reference environment variables as ${NAME}; ${NAME?} expands
+// to an empty string when NAME is unset instead of failing.
+func (c *Config) parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' || line[0] == '[' {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		value = unquote(strings.TrimSpace(value))
+		if !found {
+			value = "true"
+		}
+		// Arrays are not used by zap, the last entry wins
+		key = strings.TrimSuffix(key, "[]")
+
+		key, err := expandEnv(key)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		value, err = expandEnv(value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		c.values[key] = value
+	}
+	return scanner.Err()
+}
+
+// unquote strips the quotes around a value, as ini files allow
+func unquote(value string) string {
+	if len(value) >= 2 {
+		if (value[0] == '"' && value[len(value)-1] == '"') || (value[0] == '\'' && value[len(value)-1] == '\'') {
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
+
+// expandEnv replaces environment variable references. An odd number of
+// backslashes escapes the reference, leaving it as written.
+func expandEnv(s string) (string, error) {
+	var missing string
+	expanded := envReference.ReplaceAllStringFunc(s, func(match string) string {
+		parts := envReference.FindStringSubmatch(match)
+		escapes, name, optional := parts[1], parts[2], parts[3] == "?"
+		if len(escapes)%2 == 1 {
+			return escapes[:len(escapes)-1] + match[len(escapes):]
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok && !optional && missing == "" {
+			missing = name
+		}
+		return escapes[:len(escapes)/2] + value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("environment variable %s referenced as ${%s} is not set", missing, missing)
+	}
+	return expanded, nil
+}
+
+// Files lists the configuration files that were read, in increasing
+// precedence
+func (c *Config) Files() []string {
+	return c.files
+}
+
+// Get returns the value of a key, or an empty string when it is not set
+func (c *Config) Get(key string) string {
+	return c.values[key]
+}
+
+// Registry returns the default registry URL, always with a trailing slash
+func (c *Config) Registry() string {
+	if registry := c.values["registry"]; registry != "" {
+		return withTrailingSlash(registry)
+	}
+	return DefaultRegistry
+}
+
+// ScopeRegistries returns the registry configured for each scope, keyed by
+// scope including its @
+func (c *Config) ScopeRegistries() map[string]string {
+	scopes := make(map[string]string)
+	for key, value := range c.values {
+		scope, ok := strings.CutSuffix(key, ":registry")
+		if ok && strings.HasPrefix(scope, "@") && value != "" {
+			scopes[scope] = withTrailingSlash(value)
+		}
+	}
+	return scopes
+}
+
+// RegistryFor returns the registry serving a package, which is the
+// registry of its scope if one is configured
+func (c *Config) RegistryFor(name string) string {
+	if strings.HasPrefix(name, "@") {
+		scope, _, _ := strings.Cut(name, "/")
+		if registry := c.values[scope+":registry"]; registry != "" {
+			return withTrailingSlash(registry)
+		}
+	}
+	return c.Registry()
+}
+
+// Credentials returns the credentials configured for a URL. Credentials
+// are scoped by "nerf dart" (//host/path/) and the most specific match
+// along the URL's path wins, so //host/:_authToken also covers tarballs
+// below //host/some/path/. The legacy unscoped keys (_authToken, _auth,
+// username and _password) only apply to URLs under the default registry.
+func (c *Config) Credentials(rawURL string) *Credentials {
+	prefixes := NerfDarts(rawURL)
+	if c.underRegistry(rawURL) {
+		prefixes = append(prefixes, "")
+	}
+
+	for _, prefix := range prefixes {
+		key := func(name string) string {
+			if prefix == "" {
+				return name
+			}
+			return prefix + ":" + name
+		}
+		creds := &Credentials{
+			Token:    c.values[key("_authToken")],
+			Auth:     c.values[key("_auth")],
+			Username: c.values[key("username")],
+		}
+		if password := c.values[key("_password")]; password != "" {
+			creds.Password = decodePassword(password)
+		}
+		if !creds.Empty() {
+			return creds
+		}
+	}
+	return &Credentials{}
+}
+
+// AlwaysAuth reports whether credentials must be sent for every request to
+// a URL, including tarball downloads. As in npm, an unscoped always-auth
+// only applies to the default registry, never to other hosts.
+func (c *Config) AlwaysAuth(rawURL string) bool {
+	for _, prefix := range NerfDarts(rawURL) {
+		if value, ok := c.values[prefix+":always-auth"]; ok {
+			return value == "true"
+		}
+	}
+	return c.values["always-auth"] == "true" && c.underRegistry(rawURL)
+}
+
+// underRegistry reports whether a URL is on the default registry, at or
+// below its path
+func (c *Config) underRegistry(rawURL string) bool {
+	registry := NerfDarts(c.Registry())
+	if len(registry) == 0 {
+		return false
+	}
+	for _, prefix := range NerfDarts(rawURL) {
+		if prefix == registry[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// Secrets returns every configured credential, for masking them in logs
+func (c *Config) Secrets() []string {
+	var secrets []string
+	for key, value := range c.values {
+		switch {
+		case value == "":
+		case key == "_authToken", key == "_auth",
+			strings.HasSuffix(key, ":_authToken"), strings.HasSuffix(key, ":_auth"):
+			secrets = append(secrets, value)
+		case key == "_password", strings.HasSuffix(key, ":_password"):
+			secrets = append(secrets, value, decodePassword(value))
+		}
+	}
+	return secrets
+}
+
+// NerfDarts returns the credential keys of a URL from the most to the
+// least specific: //host/a/b/ then //host/a/ then //host/. A URL that does
+// not end in a slash is treated as naming a file in its directory.
+func NerfDarts(rawURL string) []string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return nil
+	}
+
+	dir := parsed.Path
+	if i := strings.LastIndex(dir, "/"); i >= 0 {
+		dir = dir[:i+1]
+	} else {
+		dir = "/"
+	}
+
+	var darts []string
+	for {
+		darts = append(darts, "//"+parsed.Host+dir)
+		if dir == "/" {
+			return darts
+		}
+		dir = dir[:strings.LastIndex(strings.TrimSuffix(dir, "/"), "/")+1]
+	}
+}
+
+// decodePassword decodes a _password value, which npm stores base64
+// encoded. Values that are not valid base64 are taken as they are.
+func decodePassword(value string) string {
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return value
+	}
+	return string(decoded)
+}
+
+func withTrailingSlash(u string) string {
+	if strings.HasSuffix(u, "/") {
+		return u
+	}
+	return u + "/"
+}
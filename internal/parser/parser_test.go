@@ -87,3 +87,39 @@ func TestDefaultPackageJSON(t *testing.T) {
 	assert.NotNil(t, pkg.Dependencies)
 	assert.NotNil(t, pkg.DevDependencies)
 }
+
+func TestValidateDependency(t *testing.T) {
+	valid := []string{
+		"1.2.3",
+		"^1.2",
+		"~1.2.3",
+		"1.x",
+		"2.*",
+		"*",
+		"1.2.3 - 2.3.4",
+		"^1.0.0 || ^2.0.0",
+		">=1.0.0 <2.0.0",
+		"<=1.5",
+		"!=1.2.3",
+		"latest",
+		"next",
+		"beta",
+		"file:../local-pkg",
+		"git+https://github.com/user/repo.git",
+	}
+	for _, version := range valid {
+		t.Run(version, func(t *testing.T) {
+			assert.NoError(t, validateDependency("pkg", version))
+		})
+	}
+
+	invalid := []string{"1.2.3.4", ">=>1.0.0", "^not-a-version", "next tag", "@latest"}
+	for _, version := range invalid {
+		t.Run(version, func(t *testing.T) {
+			err := validateDependency("pkg", version)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "invalid version format for dependency 'pkg'")
+			}
+		})
+	}
+}
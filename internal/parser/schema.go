@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/marpit19/zap-pm/internal/errors"
+	"github.com/marpit19/zap-pm/internal/semver"
 )
 
 // PackageJSON represents the structure of a package.json file
@@ -17,6 +18,13 @@ type PackageJSON struct {
 	Scripts         map[string]string `json:"scripts,omitempty"`
 	Dependencies    map[string]string `json:"dependencies,omitempty"`
 	DevDependencies map[string]string `json:"devDependencies,omitempty"`
+	Zap             *ZapConfig        `json:"zap,omitempty"`
+}
+
+// ZapConfig holds zap specific project settings from package.json
+type ZapConfig struct {
+	Linker        string `json:"linker,omitempty"` // "hoisted" or "isolated"
+	SingleVersion bool   `json:"singleVersion,omitempty"`
 }
 
 // ValidationError represents a package.json validation error
@@ -102,6 +110,14 @@ func validateVersion(version string) error {
 	return nil
 }
 
+var (
+	// distTagPattern matches dist-tag names such as latest, next or beta
+	distTagPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9._-]*$`)
+
+	// sourcePattern matches dependencies installed from outside the registry
+	sourcePattern = regexp.MustCompile(`^(file:.*|git\+https:\/\/.*)$`)
+)
+
 // validateDependency checks if the dependency version string is valid
 func validateDependency(name, version string) error {
 	if strings.TrimSpace(version) == "" {
@@ -110,13 +126,14 @@ func validateDependency(name, version string) error {
 			nil)
 	}
 
-	// Check for common version formats
-	valid := regexp.MustCompile(`^([\^~]?[0-9]+\.[0-9]+\.[0-9]+|latest|[*]|>=[0-9]+\.[0-9]+\.[0-9]+|file:.*|git\+https:\/\/.*)$`)
-	if !valid.MatchString(version) {
-		return errors.New(errors.ErrInvalidPackageJSON,
-			fmt.Sprintf("invalid version format for dependency '%s'", name),
-			nil)
+	// Ranges follow npm semver, anything else must be a dist-tag or a
+	// supported non-registry source
+	version = strings.TrimSpace(version)
+	if semver.ValidRange(version) || distTagPattern.MatchString(version) || sourcePattern.MatchString(version) {
+		return nil
 	}
 
-	return nil
+	return errors.New(errors.ErrInvalidPackageJSON,
+		fmt.Sprintf("invalid version format for dependency '%s'", name),
+		nil)
 }
@@ -0,0 +1,101 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultMetadataMaxAge is how long cached metadata is used without asking
+// the registry whether it changed
+const DefaultMetadataMaxAge = 5 * time.Minute
+
+// cachedMetadata is a package document stored on disk together with the
+// validators needed to revalidate it
+type cachedMetadata struct {
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"lastModified,omitempty"`
+	FetchedAt    time.Time       `json:"fetchedAt"`
+	Body         json.RawMessage `json:"body"`
+}
+
+// metadataCache keeps package documents on disk, one file per package
+type metadataCache struct {
+	dir    string
+	maxAge time.Duration
+}
+
+// fresh reports whether the entry can be used without revalidation
+func (m *metadataCache) fresh(entry *cachedMetadata) bool {
+	return time.Since(entry.FetchedAt) < m.maxAge
+}
+
+// path returns where a package document is kept. Each format has its own
+// directory, since their bodies and validators differ, and each registry
+// has its own below it, so a document is never served for a package of
+// the same name on another registry.
+func (m *metadataCache) path(registryURL, name string, format metadataFormat) string {
+	return filepath.Join(m.dir, format.String(), registryDir(registryURL), filepath.FromSlash(name)+".json")
+}
+
+// registryDir turns a registry URL into a directory name made of its host
+// and path, e.g. "npm.example.com_api_npm"
+func registryDir(registryURL string) string {
+	dir := registryURL
+	if parsed, err := url.Parse(registryURL); err == nil && parsed.Host != "" {
+		dir = parsed.Host + parsed.Path
+	}
+	dir = strings.Trim(dir, "/")
+	return strings.NewReplacer("/", "_", ":", "_", "\\", "_").Replace(dir)
+}
+
+// read returns the cached entry of a package, or nil when there is none
+// or it cannot be decoded
+func (m *metadataCache) read(registryURL, name string, format metadataFormat) *cachedMetadata {
+	data, err := os.ReadFile(m.path(registryURL, name, format))
+	if err != nil {
+		return nil
+	}
+
+	var entry cachedMetadata
+	if err := json.Unmarshal(data, &entry); err != nil || len(entry.Body) == 0 {
+		return nil
+	}
+	return &entry
+}
+
+// write stores an entry through a temporary file, so concurrent readers
+// never observe a partially written document
+func (m *metadataCache) write(registryURL, name string, format metadataFormat, entry *cachedMetadata) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cached metadata: %w", err)
+	}
+
+	path := m.path(registryURL, name, format)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create metadata cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".metadata-*")
+	if err != nil {
+		return fmt.Errorf("failed to write cached metadata: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cached metadata: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cached metadata: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write cached metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// revalidatingServer serves a single package and honors conditional requests
+type revalidatingServer struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	etag         string
+	lastModified string
+	version      string
+	full         int // requests answered with a body
+	notModified  int // requests answered with 304
+}
+
+func newRevalidatingServer(etag, lastModified string) *revalidatingServer {
+	s := &revalidatingServer{etag: etag, lastModified: lastModified, version: "1.0.0"}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if (s.etag != "" && r.Header.Get("If-None-Match") == s.etag) ||
+			(s.etag == "" && s.lastModified != "" && r.Header.Get("If-Modified-Since") == s.lastModified) {
+			s.notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		s.full++
+		if s.etag != "" {
+			w.Header().Set("ETag", s.etag)
+		}
+		if s.lastModified != "" {
+			w.Header().Set("Last-Modified", s.lastModified)
+		}
+		json.NewEncoder(w).Encode(PackageMetadata{
+			Name:     "pkg",
+			Versions: map[string]VersionInfo{s.version: {Version: s.version}},
+			DistTags: map[string]string{"latest": s.version},
+		})
+	}))
+	return s
+}
+
+func (s *revalidatingServer) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.full, s.notModified
+}
+
+func newCachingClient(t *testing.T, url, dir string, maxAge time.Duration) *RegistryClient {
+	client := NewRegistryClient(logger.New())
+	client.baseURL = url
+	client.retryConfig.RetryDelay = time.Millisecond
+	client.SetMetadataCache(dir, maxAge)
+	return client
+}
+
+func TestMetadataCacheServesFreshEntries(t *testing.T) {
+	server := newRevalidatingServer(`"v1"`, "")
+	defer server.Close()
+
+	client := newCachingClient(t, server.URL, t.TempDir(), time.Hour)
+
+	for i := 0; i < 3; i++ {
+		metadata, err := client.GetPackageMetadata(context.Background(), "pkg")
+		require.NoError(t, err)
+		assert.Equal(t, "1.0.0", metadata.DistTags["latest"])
+	}
+
+	full, notModified := server.counts()
+	assert.Equal(t, 1, full)
+	assert.Equal(t, 0, notModified)
+}
+
+func TestMetadataCacheRevalidates(t *testing.T) {
+	tests := []struct {
+		name         string
+		etag         string
+		lastModified string
+	}{
+		{name: "etag", etag: `"v1"`},
+		{name: "last modified", lastModified: "Wed, 21 Oct 2015 07:28:00 GMT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRevalidatingServer(tt.etag, tt.lastModified)
+			defer server.Close()
+
+			dir := t.TempDir()
+			client := newCachingClient(t, server.URL, dir, 0)
+
+			_, err := client.GetPackageMetadata(context.Background(), "pkg")
+			require.NoError(t, err)
+
+			// A new client, as in a later zap run, revalidates the stale entry
+			client = newCachingClient(t, server.URL, dir, 0)
+			metadata, err := client.GetPackageMetadata(context.Background(), "pkg")
+			require.NoError(t, err)
+			assert.Equal(t, "1.0.0", metadata.DistTags["latest"])
+
+			full, notModified := server.counts()
+			assert.Equal(t, 1, full)
+			assert.Equal(t, 1, notModified)
+		})
+	}
+}
+
+func TestMetadataCacheRefreshesChangedDocuments(t *testing.T) {
+	server := newRevalidatingServer(`"v1"`, "")
+	defer server.Close()
+
+	client := newCachingClient(t, server.URL, t.TempDir(), 0)
+	_, err := client.GetPackageMetadata(context.Background(), "pkg")
+	require.NoError(t, err)
+
+	server.mu.Lock()
+	server.etag = `"v2"`
+	server.version = "2.0.0"
+	server.mu.Unlock()
+
+	// A later run sees the new document
+	client = newCachingClient(t, server.URL, client.cache.dir, 0)
+	info, err := client.GetPackageVersion(context.Background(), "pkg", "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "2.0.0", info.Version)
+
+	// The new document and validator replaced the cached ones
+	cached := client.cache.read(server.URL, "pkg", formatAbbreviated)
+	require.NotNil(t, cached)
+	assert.Equal(t, `"v2"`, cached.ETag)
+}
+
+func TestMetadataCacheIgnoresCorruptEntries(t *testing.T) {
+	server := newRevalidatingServer(`"v1"`, "")
+	defer server.Close()
+
+	dir := t.TempDir()
+	client := newCachingClient(t, server.URL, dir, time.Hour)
+	path := client.cache.path(server.URL, "pkg", formatAbbreviated)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("{garbage"), 0644))
+
+	metadata, err := client.GetPackageMetadata(context.Background(), "pkg")
+	require.NoError(t, err)
+	assert.Equal(t, "pkg", metadata.Name)
+}
+
+func TestGetPackageVersionFetchesMetadataOnce(t *testing.T) {
+	server := newRevalidatingServer("", "")
+	defer server.Close()
+
+	client := NewRegistryClient(logger.New())
+	client.baseURL = server.URL
+
+	info, err := client.GetPackageVersion(context.Background(), "pkg", "^1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", info.Version)
+
+	full, _ := server.counts()
+	assert.Equal(t, 1, full)
+}
+
+func TestNetworkModes(t *testing.T) {
+	server := newRevalidatingServer(`"v1"`, "")
+	defer server.Close()
+
+	dir := t.TempDir()
+	client := newCachingClient(t, server.URL, dir, 0)
+	_, err := client.GetPackageMetadata(context.Background(), "pkg")
+	require.NoError(t, err)
+
+	t.Run("prefer offline uses stale entries", func(t *testing.T) {
+		client := newCachingClient(t, server.URL, dir, 0)
+		client.SetNetworkMode(ModePreferOffline)
+
+		_, err := client.GetPackageMetadata(context.Background(), "pkg")
+		require.NoError(t, err)
+		full, notModified := server.counts()
+		assert.Equal(t, 1, full)
+		assert.Equal(t, 0, notModified)
+
+		// Packages missing from the cache are still fetched
+		_, err = client.GetPackageMetadata(context.Background(), "other")
+		require.NoError(t, err)
+		full, _ = server.counts()
+		assert.Equal(t, 2, full)
+	})
+
+	t.Run("offline never contacts the registry", func(t *testing.T) {
+		client := newCachingClient(t, server.URL, dir, 0)
+		client.SetNetworkMode(ModeOffline)
+		before, _ := server.counts()
+
+		_, err := client.GetPackageMetadata(context.Background(), "pkg")
+		require.NoError(t, err)
+
+		_, err = client.GetPackageMetadata(context.Background(), "missing")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "offline mode")
+
+		after, notModified := server.counts()
+		assert.Equal(t, before, after)
+		assert.Equal(t, 0, notModified)
+	})
+}
+
+func TestMetadataCacheIsPerRegistry(t *testing.T) {
+	public := newRevalidatingServer(`"v1"`, "")
+	defer public.Close()
+	private := newRevalidatingServer(`"v1"`, "")
+	private.version = "9.0.0"
+	defer private.Close()
+
+	dir := t.TempDir()
+	client := newCachingClient(t, public.URL, dir, time.Hour)
+	info, err := client.GetPackageVersion(context.Background(), "pkg", "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", info.Version)
+
+	// After switching registries the fresh entry of the old one is not
+	// used, even though its ETag would still validate
+	client = newCachingClient(t, private.URL, dir, time.Hour)
+	info, err = client.GetPackageVersion(context.Background(), "pkg", "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "9.0.0", info.Version)
+
+	full, _ := private.counts()
+	assert.Equal(t, 1, full)
+
+	// Switching back serves the first registry's entry from the cache
+	client = newCachingClient(t, public.URL, dir, time.Hour)
+	info, err = client.GetPackageVersion(context.Background(), "pkg", "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", info.Version)
+	full, _ = public.counts()
+	assert.Equal(t, 1, full)
+}
+
+func TestRegistryDir(t *testing.T) {
+	assert.Equal(t, "registry.npmjs.org", registryDir("https://registry.npmjs.org/"))
+	assert.Equal(t, "npm.example.com_8080_api_npm", registryDir("https://npm.example.com:8080/api/npm/"))
+	assert.NotEqual(t, registryDir("https://npm.example.com/a/"), registryDir("https://npm.example.com/b/"))
+}
@@ -1,12 +1,14 @@
 package registry
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
 
+	"github.com/marpit19/zap-pm/internal/auth"
 	"github.com/marpit19/zap-pm/internal/errors"
 	"github.com/marpit19/zap-pm/internal/logger"
 )
@@ -20,33 +22,113 @@ const (
 // RetryConfig holds retry-related configuration
 type RetryConfig struct {
 	MaxRetries  int
-	RetryDelay  time.Duration
-	MaxWaitTime time.Duration
+	RetryDelay  time.Duration // first backoff delay, doubled on every retry
+	MaxDelay    time.Duration // cap of a single backoff delay
+	MaxWaitTime time.Duration // cap of the total time spent waiting between attempts
 }
 
 // RegistryClient handles communication with the npm registry
 type RegistryClient struct {
 	baseURL     string
+	scopes      map[string]string // registry URL per @scope
 	httpClient  *http.Client
+	auth        auth.Provider
 	retryConfig RetryConfig
+	cache       *metadataCache
+	mode        NetworkMode
+	memo        *metadataMemo
+	stats       stats
 	log         *logger.Logger
+	sleep       func(context.Context, time.Duration) error // replaced in tests
+}
+
+// Dist describes where a package tarball lives and how to verify it
+type Dist struct {
+	Tarball   string `json:"tarball"`
+	Shasum    string `json:"shasum"`
+	Integrity string `json:"integrity,omitempty"`
+}
+
+// PeerDependencyMeta holds extra information about a peer dependency
+type PeerDependencyMeta struct {
+	Optional bool `json:"optional,omitempty"`
 }
 
 // VersionInfo contains metadata about a specific package version
 type VersionInfo struct {
-	Version      string            `json:"version"`
-	Dependencies map[string]string `json:"dependencies,omitempty"`
-	Dist         struct {
-		Tarball string `json:"tarball"`
-		Shasum  string `json:"shasum"`
-	} `json:"dist"`
+	Version              string                        `json:"version"`
+	Dependencies         map[string]string             `json:"dependencies,omitempty"`
+	PeerDependencies     map[string]string             `json:"peerDependencies,omitempty"`
+	PeerDependenciesMeta map[string]PeerDependencyMeta `json:"peerDependenciesMeta,omitempty"`
+	Dist                 Dist                          `json:"dist"`
 }
 
-// PackageMetadata represents the npm package metadata
+// PackageMetadata represents the npm package metadata. It decodes both the
+// full document and the abbreviated one used for installs, which lacks
+// fields such as Description.
 type PackageMetadata struct {
-	Name     string                 `json:"name"`
-	Versions map[string]VersionInfo `json:"versions"`
-	DistTags map[string]string      `json:"dist-tags"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"` // full document only
+	Modified    string                 `json:"modified,omitempty"`    // abbreviated document only
+	Versions    map[string]VersionInfo `json:"versions"`
+	DistTags    map[string]string      `json:"dist-tags"`
+}
+
+// NetworkMode controls when the client may contact the registry
+type NetworkMode int
+
+const (
+	// ModeOnline uses cached metadata while it is fresh and revalidates it
+	// with the registry once it is stale
+	ModeOnline NetworkMode = iota
+
+	// ModePreferOffline uses cached metadata however old it is and only
+	// contacts the registry for packages missing from the cache
+	ModePreferOffline
+
+	// ModeOffline never contacts the registry and fails for packages
+	// missing from the cache
+	ModeOffline
+)
+
+func (m NetworkMode) String() string {
+	switch m {
+	case ModePreferOffline:
+		return "prefer-offline"
+	case ModeOffline:
+		return "offline"
+	default:
+		return "online"
+	}
+}
+
+// metadataFormat selects which package document the registry serves
+type metadataFormat int
+
+const (
+	// formatAbbreviated is the install document ("corgi"), listing only
+	// what is needed to resolve and fetch versions
+	formatAbbreviated metadataFormat = iota
+
+	// formatFull is the complete document with readme, maintainers and
+	// the like
+	formatFull
+)
+
+// accept returns the Accept header requesting the format. Registries that
+// do not know the abbreviated format answer with the full document.
+func (f metadataFormat) accept() string {
+	if f == formatFull {
+		return "application/json"
+	}
+	return "application/vnd.npm.install-v1+json; q=1.0, application/json; q=0.8, */*"
+}
+
+func (f metadataFormat) String() string {
+	if f == formatFull {
+		return "full"
+	}
+	return "abbreviated"
 }
 
 // NewRegistryClient creates a new registry client
@@ -59,34 +141,137 @@ func NewRegistryClient(log *logger.Logger) *RegistryClient {
 		retryConfig: RetryConfig{
 			MaxRetries:  defaultRetires,
 			RetryDelay:  time.Second,
+			MaxDelay:    defaultMaxDelay,
 			MaxWaitTime: time.Minute,
 		},
-		log: log,
+		memo:  newMetadataMemo(),
+		log:   log,
+		sleep: sleepContext,
 	}
 }
 
-// GetPackageMetadata fetches metadata for a package
-func (c *RegistryClient) GetPackageMetadata(name string) (*PackageMetadata, error) {
-	url := fmt.Sprintf("%s/%s", c.baseURL, name)
+// GetPackageMetadata fetches the abbreviated metadata of a package, which
+// holds everything needed to resolve and download its versions
+func (c *RegistryClient) GetPackageMetadata(ctx context.Context, name string) (*PackageMetadata, error) {
+	return c.getPackageMetadata(ctx, name, formatAbbreviated)
+}
 
-	var metadata PackageMetadata
-	err := c.fetchWithRetry(url, &metadata)
+// GetFullPackageMetadata fetches the complete metadata document of a
+// package, for displaying package details
+func (c *RegistryClient) GetFullPackageMetadata(ctx context.Context, name string) (*PackageMetadata, error) {
+	return c.getPackageMetadata(ctx, name, formatFull)
+}
+
+// getPackageMetadata looks a document up once per client. The returned
+// metadata is shared between callers and must not be modified.
+func (c *RegistryClient) getPackageMetadata(ctx context.Context, name string, format metadataFormat) (*PackageMetadata, error) {
+	c.stats.lookups.Add(1)
+	return c.memo.do(ctx, format.String()+":"+name, &c.stats, func() (*PackageMetadata, error) {
+		return c.loadPackageMetadata(ctx, name, format)
+	})
+}
+
+// loadPackageMetadata reads a document from the cache or the registry
+func (c *RegistryClient) loadPackageMetadata(ctx context.Context, name string, format metadataFormat) (*PackageMetadata, error) {
+	body, err := c.fetchMetadata(ctx, name, format)
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf("failed to fetch metadata for package %s", name))
 	}
 
+	var metadata PackageMetadata
+	if err := json.Unmarshal(body, &metadata); err != nil {
+		return nil, errors.New("parse_error", fmt.Sprintf("failed to parse registry response for package %s", name), err)
+	}
+
 	return &metadata, nil
 }
 
+// fetchMetadata returns the raw package document, served from the
+// metadata cache while it is fresh and revalidated with a conditional
+// request once it is not
+func (c *RegistryClient) fetchMetadata(ctx context.Context, name string, format metadataFormat) ([]byte, error) {
+	// The name becomes part of the URL and of the cache path
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+
+	registryURL := c.registryFor(name)
+	url := packageURL(registryURL, name)
+	header := make(http.Header)
+	header.Set("Accept", format.accept())
+
+	if c.cache == nil {
+		if c.mode == ModeOffline {
+			return nil, offlineMiss(name)
+		}
+		resp, err := c.fetchWithRetry(ctx, url, header)
+		if err != nil {
+			return nil, err
+		}
+		c.stats.fetched.Add(1)
+		return resp.body, nil
+	}
+
+	cached := c.cache.read(registryURL, name, format)
+	if cached != nil && (c.mode != ModeOnline || c.cache.fresh(cached)) {
+		c.log.Debugf("Metadata cache hit for %s (%s)", name, format)
+		c.stats.cacheHits.Add(1)
+		return cached.Body, nil
+	}
+
+	if c.mode == ModeOffline {
+		return nil, offlineMiss(name)
+	}
+
+	if cached != nil {
+		if cached.ETag != "" {
+			header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := c.fetchWithRetry(ctx, url, header)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := cached
+	if resp.status == http.StatusNotModified && cached != nil {
+		c.log.Debugf("Metadata for %s not modified", name)
+		c.stats.revalidated.Add(1)
+	} else {
+		c.stats.fetched.Add(1)
+		entry = &cachedMetadata{
+			ETag:         resp.header.Get("ETag"),
+			LastModified: resp.header.Get("Last-Modified"),
+			Body:         resp.body,
+		}
+	}
+	entry.FetchedAt = time.Now()
+
+	if err := c.cache.write(registryURL, name, format, entry); err != nil {
+		c.log.Warnf("Failed to cache metadata for %s: %v", name, err)
+	}
+	return entry.Body, nil
+}
+
+// offlineMiss is the error for metadata the cache cannot serve in offline
+// mode
+func offlineMiss(name string) error {
+	return errors.New("offline", fmt.Sprintf("metadata for %s is not in the metadata cache and the network is disabled (offline mode)", name), nil)
+}
+
 // GetPackageVersion fetches metadata for a specific version of a package
-func (c *RegistryClient) GetPackageVersion(name, versionConstraint string) (*VersionInfo, error) {
-	// First resolve the version constraint to a specific version
-	version, err := c.resolveVersion(name, versionConstraint)
+func (c *RegistryClient) GetPackageVersion(ctx context.Context, name, versionConstraint string) (*VersionInfo, error) {
+	metadata, err := c.GetPackageMetadata(ctx, name)
 	if err != nil {
 		return nil, err
 	}
 
-	metadata, err := c.GetPackageMetadata(name)
+	// Resolve the version constraint against the fetched versions
+	version, err := c.pickVersion(metadata, versionConstraint)
 	if err != nil {
 		return nil, err
 	}
@@ -99,9 +284,19 @@ func (c *RegistryClient) GetPackageVersion(name, versionConstraint string) (*Ver
 	return &versionInfo, nil
 }
 
+// GetDistTags fetches the dist-tags of a package, mapping tag names such as
+// latest or next to versions
+func (c *RegistryClient) GetDistTags(ctx context.Context, name string) (map[string]string, error) {
+	metadata, err := c.GetPackageMetadata(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.DistTags, nil
+}
+
 // GetLatestVersion fetches the latest version of a package
-func (c *RegistryClient) GetLatestVersion(name string) (*VersionInfo, error) {
-	metadata, err := c.GetPackageMetadata(name)
+func (c *RegistryClient) GetLatestVersion(ctx context.Context, name string) (*VersionInfo, error) {
+	metadata, err := c.GetPackageMetadata(ctx, name)
 	if err != nil {
 		return nil, err
 	}
@@ -111,52 +306,154 @@ func (c *RegistryClient) GetLatestVersion(name string) (*VersionInfo, error) {
 		return nil, errors.New("latest_version_not_found", fmt.Sprintf("latest version not found for package %s", name), nil)
 	}
 
-	return c.GetPackageVersion(name, latestVersion)
+	return c.GetPackageVersion(ctx, name, latestVersion)
+}
+
+// Stats reports how metadata lookups were served so far
+func (c *RegistryClient) Stats() Stats {
+	return c.stats.snapshot()
 }
 
 func (c *RegistryClient) SetBaseURL(url string) {
 	c.baseURL = url
 }
 
-// fetchWithRetry performs an HTTP GET request with retry logic
-func (c *RegistryClient) fetchWithRetry(url string, target interface{}) error {
+// SetAuth authenticates registry requests with provider
+func (c *RegistryClient) SetAuth(provider auth.Provider) {
+	c.auth = provider
+	auth.Wrap(c.httpClient, provider)
+}
+
+// Auth returns the provider set with SetAuth, or nil
+func (c *RegistryClient) Auth() auth.Provider {
+	return c.auth
+}
+
+// SetScopeRegistry serves packages of scope (such as @babel) from the
+// registry at url instead of the base URL
+func (c *RegistryClient) SetScopeRegistry(scope, url string) {
+	if c.scopes == nil {
+		c.scopes = make(map[string]string)
+	}
+	c.scopes[scope] = url
+}
+
+// registryFor returns the registry serving a package
+func (c *RegistryClient) registryFor(name string) string {
+	if url, ok := c.scopes[Scope(name)]; ok {
+		return url
+	}
+	return c.baseURL
+}
+
+// SetMetadataCache keeps package metadata in dir. Cached documents younger
+// than maxAge are used as they are, older ones are revalidated with the
+// registry using their ETag and Last-Modified validators.
+func (c *RegistryClient) SetMetadataCache(dir string, maxAge time.Duration) {
+	c.cache = &metadataCache{dir: dir, maxAge: maxAge}
+}
+
+// SetNetworkMode controls whether the client may contact the registry or
+// must serve metadata from the cache
+func (c *RegistryClient) SetNetworkMode(mode NetworkMode) {
+	c.mode = mode
+}
+
+// NetworkMode returns the mode set with SetNetworkMode
+func (c *RegistryClient) NetworkMode() NetworkMode {
+	return c.mode
+}
+
+// response is a fully read registry response
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// fetchWithRetry performs an HTTP GET request, retrying network errors and
+// transient failures (408, 429 and 5xx gateway errors) with capped
+// exponential backoff. Retry-After is honored on 429 and 503 answers, and
+// no more than MaxWaitTime is spent waiting in total. A 304 Not Modified
+// answer to a conditional request counts as success.
+func (c *RegistryClient) fetchWithRetry(ctx context.Context, url string, header http.Header) (*response, error) {
 	var lastErr error
+	var waited time.Duration
+	var delay time.Duration
 
 	for attempt := 0; attempt <= c.retryConfig.MaxRetries; attempt++ {
 		if attempt > 0 {
-			time.Sleep(c.retryConfig.RetryDelay * time.Duration(attempt))
+			if c.retryConfig.MaxWaitTime > 0 && waited+delay > c.retryConfig.MaxWaitTime {
+				c.log.Warnf("Giving up on %s: waiting another %s exceeds the retry budget of %s", url, delay, c.retryConfig.MaxWaitTime)
+				break
+			}
+			if err := c.sleep(ctx, delay); err != nil {
+				return nil, err
+			}
+			waited += delay
 		}
 
-		resp, err := c.httpClient.Get(url)
-		if err != nil {
-			lastErr = err
-			c.log.Warnf("Request failed (attempt %d): %v", attempt+1, err)
-			continue
+		resp, retry, err := c.fetch(ctx, url, header)
+		if err == nil {
+			return resp, nil
 		}
-		defer resp.Body.Close()
-
-		// Handle rate limiting
-		if resp.StatusCode == http.StatusTooManyRequests {
-			c.log.Warn("Rate limited by registry")
-			lastErr = errors.New("rate_limited", "too many requests to registry", nil)
-			continue
+		lastErr = err
+		if !retry {
+			return nil, err
 		}
+		c.log.Warnf("Request failed (attempt %d): %v", attempt+1, err)
 
-		// Handle other error status codes
-		if resp.StatusCode >= 400 {
-			body, _ := io.ReadAll(resp.Body)
-			lastErr = errors.New("http_error", fmt.Sprintf("HTTP %d: %s", resp.StatusCode, string(body)), nil)
-			continue
+		delay = c.retryConfig.backoff(attempt + 1)
+		if resp != nil && (resp.status == http.StatusTooManyRequests || resp.status == http.StatusServiceUnavailable) {
+			if after, ok := retryAfter(resp.header, time.Now()); ok {
+				delay = after
+			}
 		}
+	}
 
-		// Parse response
-		if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
-			lastErr = errors.New("parse_error", "failed to parse registry response", err)
-			continue
-		}
+	return nil, lastErr
+}
+
+// fetch performs a single GET request. It reports whether a failure is
+// transient; the response is returned with failed statuses so their
+// headers can be inspected.
+func (c *RegistryClient) fetch(ctx context.Context, url string, header http.Header) (*response, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, errors.New("http_error", "failed to create request", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// Cancellation is not a transient failure
+		return nil, ctx.Err() == nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, ctx.Err() == nil, err
+	}
+	result := &response{status: resp.StatusCode, header: resp.Header, body: body}
+
+	// Handle rate limiting
+	if resp.StatusCode == http.StatusTooManyRequests {
+		c.log.Warn("Rate limited by registry")
+		return result, true, errors.New("rate_limited", "too many requests to registry", nil)
+	}
+
+	// Handle other error status codes
+	if resp.StatusCode >= 400 {
+		return result, retryableStatus(resp.StatusCode), errors.New("http_error", fmt.Sprintf("HTTP %d: %s", resp.StatusCode, string(body)), nil)
+	}
 
-		return nil
+	// Truncated or garbled documents are retried as well
+	if resp.StatusCode != http.StatusNotModified && !json.Valid(body) {
+		return result, true, errors.New("parse_error", "failed to parse registry response", nil)
 	}
 
-	return lastErr
+	return result, false, nil
 }
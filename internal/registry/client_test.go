@@ -1,14 +1,17 @@
 package registry
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/marpit19/zap-pm/internal/logger"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func setupTestServer() (*httptest.Server, *RegistryClient) {
@@ -27,10 +30,7 @@ func setupTestServer() (*httptest.Server, *RegistryClient) {
 							"body-parser": "1.19.0",
 							"cookie":      "0.4.0",
 						},
-						Dist: struct {
-							Tarball string "json:\"tarball\""
-							Shasum  string "json:\"shasum\""
-						}{
+						Dist: Dist{
 							Tarball: "https://registry.npmjs.org/express/-/express-4.17.1.tgz",
 							Shasum:  "4491fc38605cf51f8629d39c2b5d026f98a4c134",
 						},
@@ -107,7 +107,7 @@ func TestGetPackageMetadata(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			meta, err := client.GetPackageMetadata(tt.packageName)
+			meta, err := client.GetPackageMetadata(context.Background(), tt.packageName)
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -167,7 +167,7 @@ func TestGetPackageVersion(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			info, err := client.GetPackageVersion(tt.packageName, tt.version)
+			info, err := client.GetPackageVersion(context.Background(), tt.packageName, tt.version)
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -215,7 +215,7 @@ func TestGetLatestVersion(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			info, err := client.GetLatestVersion(tt.packageName)
+			info, err := client.GetLatestVersion(context.Background(), tt.packageName)
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -256,8 +256,191 @@ func TestRegistryClientRetry(t *testing.T) {
 	client.baseURL = server.URL
 	client.retryConfig.RetryDelay = time.Millisecond
 
-	meta, err := client.GetPackageMetadata("test-package")
+	meta, err := client.GetPackageMetadata(context.Background(), "test-package")
 	assert.NoError(t, err)
 	assert.NotNil(t, meta)
 	assert.Equal(t, 3, attempts)
 }
+
+func TestGetDistTags(t *testing.T) {
+	server, client := setupTestServer()
+	defer server.Close()
+
+	tags, err := client.GetDistTags(context.Background(), "express")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"latest": "4.17.2"}, tags)
+
+	_, err = client.GetDistTags(context.Background(), "nonexistent")
+	assert.Error(t, err)
+}
+
+func TestMetadataFormats(t *testing.T) {
+	const abbreviated = `{
+		"name": "left-pad",
+		"modified": "2024-01-01T00:00:00.000Z",
+		"dist-tags": {"latest": "1.3.0"},
+		"versions": {
+			"1.3.0": {
+				"name": "left-pad",
+				"version": "1.3.0",
+				"dependencies": {"pad": "^1.0.0"},
+				"engines": {"node": ">=0.10"},
+				"dist": {"tarball": "https://example.com/left-pad-1.3.0.tgz", "shasum": "abc", "integrity": "sha512-abc"}
+			}
+		}
+	}`
+	const full = `{
+		"_id": "left-pad",
+		"name": "left-pad",
+		"description": "String left pad",
+		"readme": "# left-pad",
+		"maintainers": [{"name": "someone"}],
+		"time": {"1.3.0": "2018-04-09T00:00:00.000Z"},
+		"dist-tags": {"latest": "1.3.0"},
+		"versions": {
+			"1.3.0": {
+				"name": "left-pad",
+				"version": "1.3.0",
+				"description": "String left pad",
+				"dependencies": {"pad": "^1.0.0"},
+				"scripts": {"test": "node test"},
+				"dist": {"tarball": "https://example.com/left-pad-1.3.0.tgz", "shasum": "abc", "integrity": "sha512-abc"}
+			}
+		}
+	}`
+
+	var accepts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept := r.Header.Get("Accept")
+		accepts = append(accepts, accept)
+		if strings.HasPrefix(accept, "application/vnd.npm.install-v1+json") {
+			w.Header().Set("Content-Type", "application/vnd.npm.install-v1+json")
+			w.Write([]byte(abbreviated))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(full))
+	}))
+	defer server.Close()
+
+	client := NewRegistryClient(logger.New())
+	client.baseURL = server.URL
+
+	metadata, err := client.GetPackageMetadata(context.Background(), "left-pad")
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-01-01T00:00:00.000Z", metadata.Modified)
+	assert.Empty(t, metadata.Description)
+	assert.Equal(t, "sha512-abc", metadata.Versions["1.3.0"].Dist.Integrity)
+	assert.Equal(t, "^1.0.0", metadata.Versions["1.3.0"].Dependencies["pad"])
+
+	metadata, err = client.GetFullPackageMetadata(context.Background(), "left-pad")
+	assert.NoError(t, err)
+	assert.Equal(t, "String left pad", metadata.Description)
+	assert.Equal(t, "sha512-abc", metadata.Versions["1.3.0"].Dist.Integrity)
+
+	// Resolution reuses the abbreviated document fetched above
+	_, err = client.GetPackageVersion(context.Background(), "left-pad", "^1.0.0")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"application/vnd.npm.install-v1+json; q=1.0, application/json; q=0.8, */*",
+		"application/json",
+	}, accepts)
+}
+
+func TestScopeRegistries(t *testing.T) {
+	newServer := func(name string, hits *[]string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*hits = append(*hits, r.URL.Path)
+			json.NewEncoder(w).Encode(PackageMetadata{Name: name})
+		}))
+	}
+
+	var publicHits, corpHits []string
+	public := newServer("public", &publicHits)
+	defer public.Close()
+	corp := newServer("corp", &corpHits)
+	defer corp.Close()
+
+	client := NewRegistryClient(logger.New())
+	client.SetBaseURL(public.URL)
+	client.SetScopeRegistry("@corp", corp.URL)
+
+	metadata, err := client.GetPackageMetadata(context.Background(), "@corp/utils")
+	assert.NoError(t, err)
+	assert.Equal(t, "corp", metadata.Name)
+
+	metadata, err = client.GetPackageMetadata(context.Background(), "express")
+	assert.NoError(t, err)
+	assert.Equal(t, "public", metadata.Name)
+
+	_, err = client.GetPackageMetadata(context.Background(), "@other/utils")
+	assert.NoError(t, err)
+
+	assert.Len(t, corpHits, 1)
+	assert.Len(t, publicHits, 2)
+}
+
+func TestScopedPackageURLs(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.RequestURI)
+		json.NewEncoder(w).Encode(PackageMetadata{Name: strings.TrimPrefix(r.URL.Path, "/")})
+	}))
+	defer server.Close()
+
+	client := NewRegistryClient(logger.New())
+	client.SetBaseURL(server.URL + "/")
+
+	metadata, err := client.GetPackageMetadata(context.Background(), "@babel/core")
+	assert.NoError(t, err)
+	assert.Equal(t, "@babel/core", metadata.Name)
+
+	_, err = client.GetPackageMetadata(context.Background(), "express")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"/@babel%2fcore", "/express"}, requests)
+}
+
+func TestEscapeName(t *testing.T) {
+	assert.Equal(t, "express", EscapeName("express"))
+	assert.Equal(t, "@babel%2fcore", EscapeName("@babel/core"))
+	assert.Equal(t, "@babel", Scope("@babel/core"))
+	assert.Equal(t, "", Scope("express"))
+	assert.Equal(t, "https://npm.example.com/npm/@babel%2fcore", packageURL("https://npm.example.com/npm/", "@babel/core"))
+	assert.Equal(t, "https://npm.example.com/npm/express", packageURL("https://npm.example.com/npm", "express"))
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"express", "@babel/core", "lodash.merge", "JSONStream", "a-b_c~d"} {
+		assert.NoError(t, ValidateName(name), name)
+	}
+	for _, name := range []string{
+		"", "..", "../evil", "../../evil", ".hidden", "_private", "a/b", "@scope", "@scope/",
+		"@scope/..", "@../evil", "@scope/a/b", `a\b`, `@scope\evil`, "a b", "c:evil",
+	} {
+		assert.Error(t, ValidateName(name), name)
+	}
+
+	assert.NoError(t, ValidatePackage("@babel/core", "7.0.0-beta.1"))
+	assert.Error(t, ValidatePackage("express", "../4.17.1"))
+	assert.Error(t, ValidatePackage("../express", "4.17.1"))
+}
+
+func TestMetadataRejectsInvalidNames(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := NewRegistryClient(logger.New())
+	client.SetBaseURL(server.URL)
+	client.SetMetadataCache(t.TempDir(), DefaultMetadataMaxAge)
+
+	_, err := client.GetPackageMetadata(context.Background(), "../../evil")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid package name")
+	assert.Zero(t, requests)
+}
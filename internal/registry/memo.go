@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats counts how package metadata lookups were served
+type Stats struct {
+	Lookups     int64 // metadata requested by callers
+	MemoryHits  int64 // served from the in-process memo
+	Coalesced   int64 // joined an identical lookup that was already in flight
+	CacheHits   int64 // served from the on-disk cache without a request
+	Revalidated int64 // confirmed unchanged by the registry (304)
+	Fetched     int64 // downloaded from the registry
+}
+
+// String summarizes the stats on one line
+func (s Stats) String() string {
+	return fmt.Sprintf("%d lookups: %d from memory, %d coalesced, %d from disk cache, %d revalidated, %d fetched",
+		s.Lookups, s.MemoryHits, s.Coalesced, s.CacheHits, s.Revalidated, s.Fetched)
+}
+
+// stats holds the live counters behind Stats
+type stats struct {
+	lookups     atomic.Int64
+	memoryHits  atomic.Int64
+	coalesced   atomic.Int64
+	cacheHits   atomic.Int64
+	revalidated atomic.Int64
+	fetched     atomic.Int64
+}
+
+func (s *stats) snapshot() Stats {
+	return Stats{
+		Lookups:     s.lookups.Load(),
+		MemoryHits:  s.memoryHits.Load(),
+		Coalesced:   s.coalesced.Load(),
+		CacheHits:   s.cacheHits.Load(),
+		Revalidated: s.revalidated.Load(),
+		Fetched:     s.fetched.Load(),
+	}
+}
+
+// flight is a metadata lookup in progress
+type flight struct {
+	done     chan struct{}
+	metadata *PackageMetadata
+	err      error
+}
+
+// metadataMemo remembers decoded package documents for the lifetime of the
+// client and coalesces concurrent lookups of the same document, so each
+// one is fetched at most once per process. Failed lookups are not
+// remembered and are retried by the next caller.
+type metadataMemo struct {
+	mu       sync.Mutex
+	done     map[string]*PackageMetadata
+	inflight map[string]*flight
+}
+
+func newMetadataMemo() *metadataMemo {
+	return &metadataMemo{
+		done:     make(map[string]*PackageMetadata),
+		inflight: make(map[string]*flight),
+	}
+}
+
+// do returns the memoized document for key, waits for a lookup already in
+// flight or runs fetch. A waiter stops waiting when its context is done; if
+// the lookup it joined was canceled by its own caller, it starts another.
+func (m *metadataMemo) do(ctx context.Context, key string, counters *stats, fetch func() (*PackageMetadata, error)) (*PackageMetadata, error) {
+	for {
+		m.mu.Lock()
+		if metadata, ok := m.done[key]; ok {
+			m.mu.Unlock()
+			counters.memoryHits.Add(1)
+			return metadata, nil
+		}
+		if f, ok := m.inflight[key]; ok {
+			m.mu.Unlock()
+			counters.coalesced.Add(1)
+			select {
+			case <-f.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if isCanceled(f.err) && ctx.Err() == nil {
+				continue
+			}
+			return f.metadata, f.err
+		}
+
+		f := &flight{done: make(chan struct{})}
+		m.inflight[key] = f
+		m.mu.Unlock()
+
+		f.metadata, f.err = fetch()
+
+		m.mu.Lock()
+		delete(m.inflight, key)
+		if f.err == nil {
+			m.done[key] = f.metadata
+		}
+		m.mu.Unlock()
+		close(f.done)
+
+		return f.metadata, f.err
+	}
+}
+
+// isCanceled reports whether err stems from a canceled or expired context
+func isCanceled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
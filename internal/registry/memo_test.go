@@ -0,0 +1,126 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentLookupsAreCoalesced(t *testing.T) {
+	var requests atomic.Int64
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(PackageMetadata{
+			Name:     "pkg",
+			Versions: map[string]VersionInfo{"1.0.0": {Version: "1.0.0"}},
+			DistTags: map[string]string{"latest": "1.0.0"},
+		})
+	}))
+	defer server.Close()
+
+	client := NewRegistryClient(logger.New())
+	client.baseURL = server.URL
+
+	const callers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			info, err := client.GetPackageVersion(context.Background(), "pkg", "^1.0.0")
+			assert.NoError(t, err)
+			assert.Equal(t, "1.0.0", info.Version)
+		}()
+	}
+
+	// Let every caller queue up behind the first request
+	require.Eventually(t, func() bool {
+		stats := client.Stats()
+		return stats.Lookups == callers && stats.Coalesced == callers-1
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	_, err := client.GetPackageMetadata(context.Background(), "pkg")
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1), requests.Load())
+	assert.Equal(t, Stats{
+		Lookups:    callers + 1,
+		MemoryHits: 1,
+		Coalesced:  callers - 1,
+		Fetched:    1,
+	}, client.Stats())
+}
+
+func TestFailedLookupsAreNotMemoized(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(PackageMetadata{Name: "pkg"})
+	}))
+	defer server.Close()
+
+	client := NewRegistryClient(logger.New())
+	client.baseURL = server.URL
+	client.retryConfig.MaxRetries = 0
+
+	_, err := client.GetPackageMetadata(context.Background(), "pkg")
+	require.Error(t, err)
+
+	metadata, err := client.GetPackageMetadata(context.Background(), "pkg")
+	require.NoError(t, err)
+	assert.Equal(t, "pkg", metadata.Name)
+	assert.Equal(t, int64(2), requests.Load())
+}
+
+func TestCanceledLookupIsRetriedByWaiters(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// Hold the first request until its caller gives up
+			<-r.Context().Done()
+			return
+		}
+		json.NewEncoder(w).Encode(PackageMetadata{Name: "pkg"})
+	}))
+	defer server.Close()
+
+	client := NewRegistryClient(logger.New())
+	client.baseURL = server.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := client.GetPackageMetadata(ctx, "pkg")
+		first <- err
+	}()
+	require.Eventually(t, func() bool { return requests.Load() == 1 }, time.Second, time.Millisecond)
+
+	second := make(chan error, 1)
+	go func() {
+		_, err := client.GetPackageMetadata(context.Background(), "pkg")
+		second <- err
+	}()
+	require.Eventually(t, func() bool { return client.Stats().Coalesced == 1 }, time.Second, time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-first, context.Canceled)
+	assert.NoError(t, <-second)
+	assert.Equal(t, int64(2), requests.Load())
+}
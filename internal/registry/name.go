@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/marpit19/zap-pm/internal/semver"
+)
+
+// namePartPattern matches the scope or the name of a package: URL friendly
+// characters, not starting with a period or an underscore. Uppercase
+// letters and !*'() only appear in legacy names, which are still
+// installable.
+var namePartPattern = regexp.MustCompile(`^[A-Za-z0-9~-][A-Za-z0-9._~!*'()-]*$`)
+
+// ValidateName checks a package name the way npm does. Names are used as
+// paths below node_modules and zap's caches, so a valid name is a single
+// path segment, or two for @scope/name, and can never be "..", start with
+// a period or contain a backslash.
+func ValidateName(name string) error {
+	rest := name
+	if strings.HasPrefix(name, "@") {
+		scope, base, found := strings.Cut(name[1:], "/")
+		if !found || !namePartPattern.MatchString(scope) {
+			return fmt.Errorf("invalid package name %q", name)
+		}
+		rest = base
+	}
+	if !namePartPattern.MatchString(rest) {
+		return fmt.Errorf("invalid package name %q", name)
+	}
+	return nil
+}
+
+// ValidatePackage checks name with ValidateName and that version is an
+// exact version, before name@version is used as a path
+func ValidatePackage(name, version string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if _, err := semver.Parse(version); err != nil {
+		return fmt.Errorf("invalid version of %s: %w", name, err)
+	}
+	return nil
+}
+
+// Scope returns the scope of a package name including its @, or an empty
+// string for unscoped packages
+func Scope(name string) string {
+	if !strings.HasPrefix(name, "@") {
+		return ""
+	}
+	scope, _, found := strings.Cut(name, "/")
+	if !found {
+		return ""
+	}
+	return scope
+}
+
+// EscapeName returns a package name as it appears in registry URLs. The
+// slash of a scoped name is encoded, @scope/name becomes @scope%2fname, so
+// the whole name stays a single path segment.
+func EscapeName(name string) string {
+	if Scope(name) == "" {
+		return name
+	}
+	return strings.Replace(name, "/", "%2f", 1)
+}
+
+// packageURL joins a registry URL and an escaped package name, with or
+// without a trailing slash on the registry URL
+func packageURL(registryURL, name string) string {
+	return strings.TrimSuffix(registryURL, "/") + "/" + EscapeName(name)
+}
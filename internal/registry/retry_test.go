@@ -0,0 +1,151 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRetryClient returns a client against handler that records its sleeps
+// instead of waiting
+func newRetryClient(t *testing.T, handler http.HandlerFunc) (*RegistryClient, *[]time.Duration) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	var sleeps []time.Duration
+	client := NewRegistryClient(logger.New())
+	client.baseURL = server.URL
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	return client, &sleeps
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	attempts := 0
+	client, sleeps := newRetryClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		switch attempts {
+		case 1:
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.Header().Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			json.NewEncoder(w).Encode(PackageMetadata{Name: "pkg"})
+		}
+	})
+	client.retryConfig.MaxWaitTime = 2 * time.Hour
+
+	_, err := client.GetPackageMetadata(context.Background(), "pkg")
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	require.Len(t, *sleeps, 2)
+	assert.Equal(t, 2*time.Second, (*sleeps)[0])
+	assert.InDelta(t, float64(time.Hour), float64((*sleeps)[1]), float64(5*time.Second))
+}
+
+func TestRetryEnforcesMaxWaitTime(t *testing.T) {
+	attempts := 0
+	client, sleeps := newRetryClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	_, err := client.GetPackageMetadata(context.Background(), "pkg")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "HTTP 503")
+	assert.Equal(t, 1, attempts)
+	assert.Empty(t, *sleeps)
+}
+
+func TestRetrySkipsPermanentFailures(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusUnauthorized, http.StatusForbidden} {
+		attempts := 0
+		client, sleeps := newRetryClient(t, func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(status)
+		})
+
+		_, err := client.GetPackageMetadata(context.Background(), "pkg")
+		require.Error(t, err)
+		assert.Equal(t, 1, attempts, "status %d", status)
+		assert.Empty(t, *sleeps)
+	}
+}
+
+func TestRetryBacksOffExponentially(t *testing.T) {
+	client, sleeps := newRetryClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	client.retryConfig = RetryConfig{
+		MaxRetries:  4,
+		RetryDelay:  time.Second,
+		MaxDelay:    3 * time.Second,
+		MaxWaitTime: time.Minute,
+	}
+
+	_, err := client.GetPackageMetadata(context.Background(), "pkg")
+	require.Error(t, err)
+	require.Len(t, *sleeps, 4)
+
+	// Delays of 1s, 2s, 4s capped to 3s and 3s, each jittered by up to half
+	for i, ceiling := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		assert.GreaterOrEqual(t, (*sleeps)[i], ceiling/2)
+		assert.LessOrEqual(t, (*sleeps)[i], ceiling)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	header := func(value string) http.Header {
+		h := make(http.Header)
+		h.Set("Retry-After", value)
+		return h
+	}
+
+	delay, ok := retryAfter(header("30"), now)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, delay)
+
+	delay, ok = retryAfter(header("Mon, 01 Jan 2024 12:01:00 GMT"), now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, delay)
+
+	delay, ok = retryAfter(header("Mon, 01 Jan 2024 11:00:00 GMT"), now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), delay)
+
+	_, ok = retryAfter(header("soon"), now)
+	assert.False(t, ok)
+	_, ok = retryAfter(make(http.Header), now)
+	assert.False(t, ok)
+}
+
+func TestRetryStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts := 0
+	client, _ := newRetryClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	client.sleep = sleepContext
+	client.retryConfig.RetryDelay = time.Hour
+
+	_, err := client.GetPackageMetadata(ctx, "pkg")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, attempts)
+}
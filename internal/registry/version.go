@@ -5,26 +5,26 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/Masterminds/semver/v3"
+	"github.com/marpit19/zap-pm/internal/semver"
 )
 
-// resolveVersion resolves a version constraint to a specific version
-func (c *RegistryClient) resolveVersion(name, versionConstraint string) (string, error) {
-	c.log.Debugf("Resolving version constraint %s for package %s", versionConstraint, name)
-
+// pickVersion resolves a version constraint against the versions listed in
+// metadata
+func (c *RegistryClient) pickVersion(metadata *PackageMetadata, versionConstraint string) (string, error) {
 	// If it's an exact version, just return it
 	if isExactVersion(versionConstraint) {
-		return versionConstraint, nil
+		v, _ := semver.Parse(versionConstraint)
+		return v.String(), nil
 	}
 
-	// Get package metadata
-	metadata, err := c.GetPackageMetadata(name)
-	if err != nil {
-		return "", fmt.Errorf("failed to get package metadata: %w", err)
+	// Dist-tags such as latest or next point at a single version
+	if version, ok := metadata.DistTags[versionConstraint]; ok {
+		c.log.Debugf("Resolved dist-tag %s to version %s", versionConstraint, version)
+		return version, nil
 	}
 
 	// Parse version constraint
-	constraint, err := semver.NewConstraint(versionConstraint)
+	constraint, err := semver.ParseRange(versionConstraint)
 	if err != nil {
 		return "", fmt.Errorf("invalid version constraint %s: %w", versionConstraint, err)
 	}
@@ -32,7 +32,7 @@ func (c *RegistryClient) resolveVersion(name, versionConstraint string) (string,
 	// Get all available versions
 	var versions []*semver.Version
 	for version := range metadata.Versions {
-		v, err := semver.NewVersion(version)
+		v, err := semver.Parse(version)
 		if err != nil {
 			c.log.Debugf("Skipping invalid version %s: %v", version, err)
 			continue
@@ -41,11 +41,13 @@ func (c *RegistryClient) resolveVersion(name, versionConstraint string) (string,
 	}
 
 	// Sort versions in descending order (highest first)
-	sort.Sort(sort.Reverse(semver.Collection(versions)))
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Compare(versions[j]) > 0
+	})
 
 	// Find the highest version that satisfies the constraint
 	for _, v := range versions {
-		if constraint.Check(v) {
+		if constraint.Test(v) {
 			resolvedVersion := v.String()
 			c.log.Debugf("Resolved %s to version %s", versionConstraint, resolvedVersion)
 			return resolvedVersion, nil
@@ -72,6 +74,12 @@ func isExactVersion(version string) bool {
 	}
 
 	// Try to parse as semver
-	_, err := semver.NewVersion(version)
+	_, err := semver.Parse(version)
 	return err == nil
 }
+
+// Satisfies reports whether version matches the version constraint,
+// following npm's range semantics
+func Satisfies(version, versionConstraint string) (bool, error) {
+	return semver.Satisfies(version, versionConstraint)
+}
@@ -1,6 +1,7 @@
 package registry
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -37,6 +38,7 @@ func setupVersionTestServer() (*httptest.Server, *RegistryClient) {
 				},
 				DistTags: map[string]string{
 					"latest": "4.17.1",
+					"legacy": "4.17.0",
 				},
 			})
 		case "/nonexistent":
@@ -86,6 +88,54 @@ func TestVersionResolution(t *testing.T) {
 			constraint: ">=4.17.0",
 			expected:   "4.17.1",
 		},
+		{
+			name:       "partial caret",
+			pkgName:    "express",
+			constraint: "^4.17",
+			expected:   "4.17.1",
+		},
+		{
+			name:       "hyphen range",
+			pkgName:    "express",
+			constraint: "4.0.0 - 4.17.0",
+			expected:   "4.17.0",
+		},
+		{
+			name:       "x-range union",
+			pkgName:    "express",
+			constraint: "3.x || 4.17.x",
+			expected:   "4.17.1",
+		},
+		{
+			name:       "less than or equal",
+			pkgName:    "express",
+			constraint: "<=4.17.0",
+			expected:   "4.17.0",
+		},
+		{
+			name:       "not equal",
+			pkgName:    "express",
+			constraint: ">=4.0.0 !=4.17.1",
+			expected:   "4.17.0",
+		},
+		{
+			name:       "latest dist-tag",
+			pkgName:    "express",
+			constraint: "latest",
+			expected:   "4.17.1",
+		},
+		{
+			name:       "custom dist-tag",
+			pkgName:    "express",
+			constraint: "legacy",
+			expected:   "4.17.0",
+		},
+		{
+			name:        "unknown dist-tag",
+			pkgName:     "express",
+			constraint:  "next",
+			expectError: true,
+		},
 		{
 			name:        "invalid constraint",
 			pkgName:     "express",
@@ -102,7 +152,9 @@ func TestVersionResolution(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			version, err := client.resolveVersion(tt.pkgName, tt.constraint)
+			metadata, err := client.GetPackageMetadata(context.Background(), tt.pkgName)
+			require.NoError(t, err)
+			version, err := client.pickVersion(metadata, tt.constraint)
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -113,7 +165,7 @@ func TestVersionResolution(t *testing.T) {
 			assert.Equal(t, tt.expected, version)
 
 			// Verify we can actually get this version
-			versionInfo, err := client.GetPackageVersion(tt.pkgName, version)
+			versionInfo, err := client.GetPackageVersion(context.Background(), tt.pkgName, version)
 			require.NoError(t, err)
 			assert.Equal(t, version, versionInfo.Version)
 		})
@@ -135,6 +187,9 @@ func TestIsExactVersion(t *testing.T) {
 		{"*", false},
 		{"", false},
 		{" 1.0.0 ", true},
+		{"v1.0.0", true},
+		{"1.x", false},
+		{"1.2", false},
 	}
 
 	for _, tt := range tests {
@@ -144,3 +199,35 @@ func TestIsExactVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestSatisfies(t *testing.T) {
+	tests := []struct {
+		version    string
+		constraint string
+		want       bool
+		wantErr    bool
+	}{
+		{"1.2.0", "^1.0.0", true, false},
+		{"2.0.0", "^1.0.0", false, false},
+		{"1.0.5", "~1.0.0", true, false},
+		{"1.0.0", "1.0.0", true, false},
+		{"1.5.0", "1.2.3 - 2.3.4", true, false},
+		{"2.1.0", "1.x || 2.*", true, false},
+		{"1.3.0-beta.1", "^1.2.3", false, false},
+		{"1.2.3-beta.2", "^1.2.3-beta.1", true, false},
+		{"1.0.0", "invalid", false, true},
+		{"invalid", "^1.0.0", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version+" "+tt.constraint, func(t *testing.T) {
+			got, err := Satisfies(tt.version, tt.constraint)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package resolver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// projectLabel names the project itself in explanations
+const projectLabel = "package.json"
+
+// Constraint is a requirement a dependent places on a package
+type Constraint struct {
+	Name   string
+	Spec   string
+	Origin string // name@version of the dependent, empty for the project
+	Peer   bool
+
+	// Chain lists the dependents through which Origin was pulled in,
+	// nearest first, ending before the project itself
+	Chain []string
+}
+
+// String describes the constraint, e.g. "a@1.0.0 requires b@^2.0.0"
+func (c Constraint) String() string {
+	kind := ""
+	if c.Peer {
+		kind = "peer "
+	}
+	return fmt.Sprintf("%s requires %s%s@%s", originLabel(c.Origin), kind, c.Name, c.Spec)
+}
+
+// ConflictError reports constraints on a package that no single version
+// satisfies together
+type ConflictError struct {
+	Name        string
+	Constraints []Constraint
+}
+
+func (e *ConflictError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "unable to resolve %s: ", e.Name)
+
+	for i, c := range e.Constraints {
+		switch {
+		case i == 0:
+		case i == 1:
+			b.WriteString(", but ")
+		default:
+			b.WriteString(" and ")
+		}
+		b.WriteString(c.String())
+	}
+
+	for _, c := range e.Constraints {
+		if len(c.Chain) == 0 {
+			continue
+		}
+		chain := append(append([]string{}, c.Chain...), projectLabel)
+		fmt.Fprintf(&b, "\n  %s is required by %s", c.Origin, strings.Join(chain, " <- "))
+	}
+	return b.String()
+}
+
+// NoMatchError reports a specifier that no published version satisfies
+type NoMatchError struct {
+	Constraint Constraint
+}
+
+func (e *NoMatchError) Error() string {
+	return fmt.Sprintf("no version of %s matches %s (required by %s)", e.Constraint.Name, e.Constraint.Spec, originLabel(e.Constraint.Origin))
+}
+
+func originLabel(origin string) string {
+	if origin == "" {
+		return projectLabel
+	}
+	return origin
+}
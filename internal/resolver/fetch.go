@@ -0,0 +1,76 @@
+package resolver
+
+import (
+	"context"
+	"sync"
+
+	"github.com/marpit19/zap-pm/internal/registry"
+)
+
+// metadataEntry is a metadata request that is in flight or finished
+type metadataEntry struct {
+	done     chan struct{}
+	metadata *registry.PackageMetadata
+	err      error
+}
+
+// fetcher loads package metadata in the background, so the registry is
+// queried concurrently while the search itself stays single threaded
+type fetcher struct {
+	ctx       context.Context
+	source    Source
+	semaphore chan struct{}
+
+	mu      sync.Mutex
+	entries map[string]*metadataEntry
+}
+
+func newFetcher(ctx context.Context, source Source, concurrency int) *fetcher {
+	return &fetcher{
+		ctx:       ctx,
+		source:    source,
+		semaphore: make(chan struct{}, concurrency),
+		entries:   make(map[string]*metadataEntry),
+	}
+}
+
+// prefetch starts loading the metadata of a package unless it is already
+// known or being loaded
+func (f *fetcher) prefetch(name string) *metadataEntry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if entry, ok := f.entries[name]; ok {
+		return entry
+	}
+
+	entry := &metadataEntry{done: make(chan struct{})}
+	f.entries[name] = entry
+
+	go func() {
+		defer close(entry.done)
+
+		select {
+		case f.semaphore <- struct{}{}:
+		case <-f.ctx.Done():
+			entry.err = f.ctx.Err()
+			return
+		}
+		defer func() { <-f.semaphore }()
+
+		entry.metadata, entry.err = f.source.GetPackageMetadata(f.ctx, name)
+	}()
+
+	return entry
+}
+
+// get waits for the metadata of a package
+func (f *fetcher) get(name string) (*registry.PackageMetadata, error) {
+	entry := f.prefetch(name)
+	select {
+	case <-entry.done:
+		return entry.metadata, entry.err
+	case <-f.ctx.Done():
+		return nil, f.ctx.Err()
+	}
+}
@@ -0,0 +1,497 @@
+// Package resolver picks package versions for a dependency graph. Unlike
+// resolving every specifier on its own, it considers all constraints on a
+// package together, backtracks when earlier choices make later ones
+// impossible and explains which dependents disagree when no solution
+// exists.
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/marpit19/zap-pm/internal/registry"
+	"github.com/marpit19/zap-pm/internal/semver"
+)
+
+const (
+	defaultConcurrency = 8
+
+	// maxBacktracks bounds the number of rejected candidates before giving
+	// up. Choices that work out are not counted, so large graphs without
+	// conflicts never hit it.
+	maxBacktracks = 10000
+)
+
+var errGaveUp = errors.New("too many backtracks")
+
+// Source provides package metadata to the resolver
+type Source interface {
+	GetPackageMetadata(ctx context.Context, name string) (*registry.PackageMetadata, error)
+}
+
+// Options controls the resolution policy
+type Options struct {
+	// SingleVersion resolves every package to exactly one version across
+	// the whole graph instead of allowing dependents to disagree
+	SingleVersion bool
+
+	// Concurrency limits parallel metadata requests
+	Concurrency int
+
+	// Preferred lists versions by package name, such as those recorded in
+	// a lock file, that are tried before any other candidate. They are
+	// only picked when they satisfy every constraint, like any other
+	// candidate.
+	Preferred map[string][]string
+}
+
+// Package is a resolved package version
+type Package struct {
+	Name         string
+	Version      string
+	Dist         registry.Dist
+	Dependencies map[string]string // dependency name -> resolved version, peers included
+}
+
+// Key returns the name@version identifier of the package
+func (p *Package) Key() string {
+	return packageKey(p.Name, p.Version)
+}
+
+// Resolution is the outcome of a successful resolution
+type Resolution struct {
+	Root     map[string]string   // direct dependency name -> resolved version
+	Packages map[string]*Package // keyed by name@version
+}
+
+// requirement is a dependency specifier waiting to be resolved
+type requirement struct {
+	name     string
+	spec     string
+	parent   string // name@version of the dependent, empty for the project
+	peer     bool
+	optional bool
+}
+
+// state is the search state. It is modified in place; every change is
+// recorded in an undo log, so a failed branch is rolled back before its
+// alternatives are tried instead of copying the state at every choice.
+type state struct {
+	shared      map[string]string                // name -> the version every shared requirement uses
+	constraints map[string][]Constraint          // constraints on shared versions
+	packages    map[string]*registry.VersionInfo // activated packages by name@version
+	versions    map[string][]string              // name -> activated versions
+	parents     map[string]string                // name@version -> dependent that first required it
+	edges       map[string]string                // dependent + "\x00" + name -> version
+	queue       []requirement
+	undo        []func()
+}
+
+// mark is a point of the search that the state can be rolled back to
+type mark struct {
+	undo  int
+	queue []requirement
+}
+
+// Resolver searches for a set of versions satisfying every constraint
+type Resolver struct {
+	source     Source
+	fetcher    *fetcher // set for the duration of Resolve
+	opts       Options
+	log        *logger.Logger
+	backtracks int
+	conflict   error // first conflict met, reported if the search gives up
+}
+
+// New creates a resolver reading metadata from source
+func New(source Source, opts Options, log *logger.Logger) *Resolver {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	return &Resolver{
+		source: source,
+		opts:   opts,
+		log:    log,
+	}
+}
+
+// Resolve picks a version for deps and every transitive dependency.
+// Direct dependencies and peer dependencies always share a single version
+// per package; other dependencies share one when their ranges allow it.
+// With Options.SingleVersion every package has exactly one version.
+// Canceling ctx stops pending metadata requests and fails the resolution.
+func (r *Resolver) Resolve(ctx context.Context, deps map[string]string) (*Resolution, error) {
+	r.fetcher = newFetcher(ctx, r.source, r.opts.Concurrency)
+	defer func() { r.fetcher = nil }()
+
+	s := &state{
+		shared:      make(map[string]string),
+		constraints: make(map[string][]Constraint),
+		packages:    make(map[string]*registry.VersionInfo),
+		versions:    make(map[string][]string),
+		parents:     make(map[string]string),
+		edges:       make(map[string]string),
+	}
+	for _, name := range sortedKeys(deps) {
+		s.enqueue(r, requirement{name: name, spec: deps[name]})
+	}
+
+	solved, err := r.solve(s)
+	if errors.Is(err, errGaveUp) {
+		if r.conflict != nil {
+			err = r.conflict
+		}
+		return nil, fmt.Errorf("resolution gave up after %d backtracks: %w", maxBacktracks, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.log.Debugf("Resolved %d packages with %d backtracks", len(solved.packages), r.backtracks)
+	return solved.resolution(), nil
+}
+
+// solve processes queued requirements until the queue is empty or a choice
+// between several versions has to be made
+func (r *Resolver) solve(s *state) (*state, error) {
+	for len(s.queue) > 0 {
+		req := s.queue[0]
+		s.queue = s.queue[1:]
+
+		// Names published in dependencies end up as paths in node_modules
+		if err := registry.ValidateName(req.name); err != nil {
+			return nil, fmt.Errorf("failed to resolve %s@%s (required by %s): %w", req.name, req.spec, originLabel(req.parent), err)
+		}
+		metadata, err := r.fetcher.get(req.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s@%s (required by %s): %w", req.name, req.spec, originLabel(req.parent), err)
+		}
+		c := s.constraint(req)
+
+		if !r.opts.SingleVersion && req.parent != "" && !req.peer {
+			// Reuse an activated version when the range allows it
+			if version := s.reusable(metadata, req); version != "" {
+				set(s, s.edges, edgeKey(req.parent, req.name), version)
+				continue
+			}
+
+			candidates := matching(metadata, req.spec, nil)
+			if len(candidates) == 0 {
+				return nil, &NoMatchError{Constraint: c}
+			}
+			return r.branch(s, req, metadata, r.prefer(req.name, candidates), false)
+		}
+
+		if version, ok := s.shared[req.name]; ok {
+			if !matches(metadata, version, req.spec) {
+				return nil, r.conflictError(metadata, s.constraints[req.name], c)
+			}
+			s.addConstraint(c)
+			set(s, s.edges, edgeKey(req.parent, req.name), version)
+			continue
+		}
+
+		if req.optional {
+			// Optional peers only constrain a version someone else installs
+			s.addConstraint(c)
+			continue
+		}
+
+		candidates := matching(metadata, req.spec, s.constraints[req.name])
+		if len(candidates) == 0 {
+			if len(matching(metadata, req.spec, nil)) == 0 {
+				return nil, &NoMatchError{Constraint: c}
+			}
+			return nil, r.conflictError(metadata, s.constraints[req.name], c)
+		}
+		s.addConstraint(c)
+		return r.branch(s, req, metadata, r.prefer(req.name, candidates), true)
+	}
+
+	return s, nil
+}
+
+// prefer moves the preferred versions of a package to the front of its
+// candidates, keeping the order within both groups
+func (r *Resolver) prefer(name string, candidates []string) []string {
+	preferred := r.opts.Preferred[name]
+	if len(preferred) == 0 {
+		return candidates
+	}
+
+	ordered := make([]string, 0, len(candidates))
+	var rest []string
+	for _, version := range candidates {
+		if slices.Contains(preferred, version) {
+			ordered = append(ordered, version)
+		} else {
+			rest = append(rest, version)
+		}
+	}
+	return append(ordered, rest...)
+}
+
+// branch tries the candidates of a requirement in order, preferred
+// versions first and then from the highest version down, and returns the first complete solution. A rejected candidate is
+// rolled back before the next one is tried. The error of the highest
+// candidate is reported when none of them works out.
+func (r *Resolver) branch(s *state, req requirement, metadata *registry.PackageMetadata, candidates []string, shared bool) (*state, error) {
+	var firstErr error
+	start := s.mark()
+
+	for i, version := range candidates {
+		if i > 0 {
+			r.backtracks++
+			if r.backtracks > maxBacktracks {
+				return nil, errGaveUp
+			}
+			s.rollback(start)
+		}
+
+		if shared {
+			set(s, s.shared, req.name, version)
+		}
+		info := metadata.Versions[version]
+		s.activate(r, req, &info)
+
+		solved, err := r.solve(s)
+		if err == nil {
+			return solved, nil
+		}
+		if errors.Is(err, errGaveUp) {
+			return nil, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		r.log.Debugf("Backtracking from %s@%s: %v", req.name, version, err)
+	}
+
+	return nil, firstErr
+}
+
+// conflictError explains why c cannot be met together with the existing
+// constraints, narrowing it down to a single disagreeing dependent when
+// possible
+func (r *Resolver) conflictError(metadata *registry.PackageMetadata, existing []Constraint, c Constraint) error {
+	conflicting := append(append([]Constraint{}, existing...), c)
+	for _, other := range existing {
+		if len(matching(metadata, c.Spec, []Constraint{other})) == 0 {
+			conflicting = []Constraint{other, c}
+			break
+		}
+	}
+
+	err := &ConflictError{Name: c.Name, Constraints: conflicting}
+	if r.conflict == nil {
+		r.conflict = err
+	}
+	return err
+}
+
+// activate records that req resolved to info and queues its dependencies
+func (s *state) activate(r *Resolver, req requirement, info *registry.VersionInfo) {
+	set(s, s.edges, edgeKey(req.parent, req.name), info.Version)
+
+	key := packageKey(req.name, info.Version)
+	if _, ok := s.packages[key]; ok {
+		return
+	}
+	set(s, s.packages, key, info)
+	set(s, s.versions, req.name, appendCopy(s.versions[req.name], info.Version))
+	set(s, s.parents, key, req.parent)
+
+	for _, name := range sortedKeys(info.Dependencies) {
+		s.enqueue(r, requirement{name: name, spec: info.Dependencies[name], parent: key})
+	}
+	for _, name := range sortedKeys(info.PeerDependencies) {
+		if _, ok := info.Dependencies[name]; ok {
+			continue
+		}
+		s.enqueue(r, requirement{
+			name:     name,
+			spec:     info.PeerDependencies[name],
+			parent:   key,
+			peer:     true,
+			optional: info.PeerDependenciesMeta[name].Optional,
+		})
+	}
+}
+
+func (s *state) enqueue(r *Resolver, req requirement) {
+	r.fetcher.prefetch(req.name)
+	s.queue = append(s.queue, req)
+}
+
+// reusable returns the highest activated version of a package matching
+// the requirement, or an empty string
+func (s *state) reusable(metadata *registry.PackageMetadata, req requirement) string {
+	best := ""
+	for _, version := range s.versions[req.name] {
+		if matches(metadata, version, req.spec) && (best == "" || compareVersions(version, best) > 0) {
+			best = version
+		}
+	}
+	return best
+}
+
+// constraint describes req along with the chain of dependents behind it
+func (s *state) constraint(req requirement) Constraint {
+	var chain []string
+	for parent := s.parents[req.parent]; parent != ""; parent = s.parents[parent] {
+		chain = append(chain, parent)
+	}
+	return Constraint{
+		Name:   req.name,
+		Spec:   req.spec,
+		Origin: req.parent,
+		Peer:   req.peer,
+		Chain:  chain,
+	}
+}
+
+func (s *state) addConstraint(c Constraint) {
+	set(s, s.constraints, c.Name, appendCopy(s.constraints[c.Name], c))
+}
+
+// mark returns the current point of the search
+func (s *state) mark() mark {
+	return mark{undo: len(s.undo), queue: s.queue}
+}
+
+// rollback reverts every change made since m was taken. Requirements are
+// only ever appended behind the marked queue, so restoring the slice
+// restores the queue.
+func (s *state) rollback(m mark) {
+	for i := len(s.undo) - 1; i >= m.undo; i-- {
+		s.undo[i]()
+	}
+	s.undo = s.undo[:m.undo]
+	s.queue = m.queue
+}
+
+// set assigns m[key] = value and logs how to revert it
+func set[K comparable, V any](s *state, m map[K]V, key K, value V) {
+	old, existed := m[key]
+	s.undo = append(s.undo, func() {
+		if existed {
+			m[key] = old
+		} else {
+			delete(m, key)
+		}
+	})
+	m[key] = value
+}
+
+// resolution turns a solved state into the packages and their edges
+func (s *state) resolution() *Resolution {
+	res := &Resolution{
+		Root:     make(map[string]string),
+		Packages: make(map[string]*Package, len(s.packages)),
+	}
+
+	for key, info := range s.packages {
+		res.Packages[key] = &Package{
+			Name:         strings.TrimSuffix(key, "@"+info.Version),
+			Version:      info.Version,
+			Dist:         info.Dist,
+			Dependencies: make(map[string]string),
+		}
+	}
+
+	for key, version := range s.edges {
+		parent, name, _ := strings.Cut(key, "\x00")
+		if parent == "" {
+			res.Root[name] = version
+		} else {
+			res.Packages[parent].Dependencies[name] = version
+		}
+	}
+
+	// Optional peers are linked when something else installed them
+	for key, info := range s.packages {
+		for name, meta := range info.PeerDependenciesMeta {
+			if _, ok := info.PeerDependencies[name]; !ok || !meta.Optional {
+				continue
+			}
+			if version, ok := s.shared[name]; ok {
+				res.Packages[key].Dependencies[name] = version
+			}
+		}
+	}
+
+	return res
+}
+
+// matching returns the versions of a package matching spec and every
+// constraint, highest first. Specifiers naming a dist-tag match the
+// version the tag points to.
+func matching(metadata *registry.PackageMetadata, spec string, constraints []Constraint) []string {
+	var versions []string
+	for version := range metadata.Versions {
+		if !matches(metadata, version, spec) {
+			continue
+		}
+		ok := true
+		for _, c := range constraints {
+			if !matches(metadata, version, c.Spec) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			versions = append(versions, version)
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return compareVersions(versions[i], versions[j]) > 0
+	})
+	return versions
+}
+
+func matches(metadata *registry.PackageMetadata, version, spec string) bool {
+	if tagged, ok := metadata.DistTags[spec]; ok {
+		return version == tagged
+	}
+	ok, err := registry.Satisfies(version, spec)
+	return err == nil && ok
+}
+
+// compareVersions orders versions by semver precedence, falling back to
+// string order for versions that do not parse
+func compareVersions(a, b string) int {
+	c, err := semver.Compare(a, b)
+	if err != nil {
+		return strings.Compare(a, b)
+	}
+	return c
+}
+
+// appendCopy appends without writing into a backing array that a value
+// kept in the undo log may share
+func appendCopy[T any](s []T, v T) []T {
+	return append(s[:len(s):len(s)], v)
+}
+
+func edgeKey(parent, name string) string {
+	return parent + "\x00" + name
+}
+
+func packageKey(name, version string) string {
+	return name + "@" + version
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,250 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/marpit19/zap-pm/internal/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource serves metadata from memory
+type fakeSource map[string]*registry.PackageMetadata
+
+func (f fakeSource) GetPackageMetadata(ctx context.Context, name string) (*registry.PackageMetadata, error) {
+	metadata, ok := f[name]
+	if !ok {
+		return nil, fmt.Errorf("HTTP 404: package %s not found", name)
+	}
+	return metadata, nil
+}
+
+// add registers a package version and points latest at it; deps and peers
+// may be nil
+func (f fakeSource) add(name, version string, deps, peers map[string]string) {
+	metadata, ok := f[name]
+	if !ok {
+		metadata = &registry.PackageMetadata{
+			Name:     name,
+			Versions: make(map[string]registry.VersionInfo),
+			DistTags: make(map[string]string),
+		}
+		f[name] = metadata
+	}
+	info := registry.VersionInfo{
+		Version:          version,
+		Dependencies:     deps,
+		PeerDependencies: peers,
+		Dist:             registry.Dist{Tarball: fmt.Sprintf("https://example.com/%s-%s.tgz", name, version)},
+	}
+	metadata.Versions[version] = info
+	metadata.DistTags["latest"] = version
+}
+
+func resolve(t *testing.T, source fakeSource, deps map[string]string, opts Options) (*Resolution, error) {
+	t.Helper()
+	return New(source, opts, logger.New()).Resolve(context.Background(), deps)
+}
+
+func TestResolveSharesCompatibleVersions(t *testing.T) {
+	source := fakeSource{}
+	source.add("a", "1.0.0", map[string]string{"b": "^1.0.0"}, nil)
+	source.add("b", "1.0.0", nil, nil)
+	source.add("b", "1.2.0", nil, nil)
+	source.add("b", "2.0.0", nil, nil)
+
+	res, err := resolve(t, source, map[string]string{"a": "^1.0.0", "b": "1.0.0"}, Options{})
+	require.NoError(t, err)
+
+	// a accepts the b the project already pinned instead of b@1.2.0
+	assert.Equal(t, map[string]string{"a": "1.0.0", "b": "1.0.0"}, res.Root)
+	assert.Equal(t, map[string]string{"b": "1.0.0"}, res.Packages["a@1.0.0"].Dependencies)
+	assert.Len(t, res.Packages, 2)
+}
+
+func TestResolveAllowsDisagreeingRanges(t *testing.T) {
+	source := fakeSource{}
+	source.add("a", "1.0.0", map[string]string{"b": "^2.0.0"}, nil)
+	source.add("b", "1.0.0", nil, nil)
+	source.add("b", "2.0.0", nil, nil)
+
+	res, err := resolve(t, source, map[string]string{"a": "1.0.0", "b": "^1.0.0"}, Options{})
+	require.NoError(t, err)
+
+	assert.Equal(t, "1.0.0", res.Root["b"])
+	assert.Equal(t, "2.0.0", res.Packages["a@1.0.0"].Dependencies["b"])
+	assert.Contains(t, res.Packages, "b@1.0.0")
+	assert.Contains(t, res.Packages, "b@2.0.0")
+}
+
+func TestResolveBacktracksOnPeerConflict(t *testing.T) {
+	source := fakeSource{}
+	source.add("plugin", "1.0.0", nil, map[string]string{"host": "^1.0.0"})
+	source.add("plugin", "2.0.0", nil, map[string]string{"host": "^2.0.0"})
+	source.add("host", "1.0.0", nil, nil)
+	source.add("host", "1.5.0", nil, nil)
+	source.add("host", "2.0.0", nil, nil)
+
+	res, err := resolve(t, source, map[string]string{"plugin": "*", "host": "^1.0.0"}, Options{})
+	require.NoError(t, err)
+
+	// plugin@2 needs host@2, so the resolver falls back to plugin@1
+	assert.Equal(t, map[string]string{"plugin": "1.0.0", "host": "1.5.0"}, res.Root)
+	assert.Equal(t, map[string]string{"host": "1.5.0"}, res.Packages["plugin@1.0.0"].Dependencies)
+	assert.NotContains(t, res.Packages, "plugin@2.0.0")
+}
+
+func TestResolveInstallsMissingPeers(t *testing.T) {
+	source := fakeSource{}
+	source.add("plugin", "1.0.0", nil, map[string]string{"host": "^1.0.0", "extra": "^1.0.0"})
+	plugin := source["plugin"].Versions["1.0.0"]
+	plugin.PeerDependenciesMeta = map[string]registry.PeerDependencyMeta{"extra": {Optional: true}}
+	source["plugin"].Versions["1.0.0"] = plugin
+	source.add("host", "1.0.0", nil, nil)
+	source.add("extra", "1.0.0", nil, nil)
+
+	res, err := resolve(t, source, map[string]string{"plugin": "1.0.0"}, Options{})
+	require.NoError(t, err)
+
+	// Required peers are installed, optional ones only when present
+	assert.Equal(t, map[string]string{"host": "1.0.0"}, res.Packages["plugin@1.0.0"].Dependencies)
+	assert.NotContains(t, res.Packages, "extra@1.0.0")
+
+	res, err = resolve(t, source, map[string]string{"plugin": "1.0.0", "extra": "1.0.0"}, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"host": "1.0.0", "extra": "1.0.0"}, res.Packages["plugin@1.0.0"].Dependencies)
+}
+
+func TestResolveSingleVersion(t *testing.T) {
+	source := fakeSource{}
+	source.add("a", "1.0.0", map[string]string{"b": "^1.0.0"}, nil)
+	source.add("c", "1.0.0", map[string]string{"b": "~1.1.0"}, nil)
+	source.add("b", "1.1.0", nil, nil)
+	source.add("b", "1.2.0", nil, nil)
+
+	res, err := resolve(t, source, map[string]string{"a": "1.0.0", "c": "1.0.0"}, Options{SingleVersion: true})
+	require.NoError(t, err)
+
+	// a alone would pick b@1.2.0; c narrows the single b down to 1.1.x
+	assert.Equal(t, "1.1.0", res.Packages["a@1.0.0"].Dependencies["b"])
+	assert.Equal(t, "1.1.0", res.Packages["c@1.0.0"].Dependencies["b"])
+	assert.NotContains(t, res.Packages, "b@1.2.0")
+}
+
+func TestResolveExplainsConflicts(t *testing.T) {
+	source := fakeSource{}
+	source.add("a", "1.0.0", map[string]string{"b": "^2.0.0"}, nil)
+	source.add("x", "1.0.0", map[string]string{"c": "^3.0.0"}, nil)
+	source.add("c", "3.0.0", map[string]string{"b": "^1.0.0"}, nil)
+	source.add("b", "1.0.0", nil, nil)
+	source.add("b", "2.0.0", nil, nil)
+
+	_, err := resolve(t, source, map[string]string{"a": "1.0.0", "x": "1.0.0"}, Options{SingleVersion: true})
+	require.Error(t, err)
+
+	var conflict *ConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "b", conflict.Name)
+	assert.Equal(t, "unable to resolve b: a@1.0.0 requires b@^2.0.0, but c@3.0.0 requires b@^1.0.0\n"+
+		"  c@3.0.0 is required by x@1.0.0 <- package.json", err.Error())
+}
+
+func TestResolveNoMatchingVersion(t *testing.T) {
+	source := fakeSource{}
+	source.add("a", "1.0.0", map[string]string{"b": "^9.0.0"}, nil)
+	source.add("b", "1.0.0", nil, nil)
+
+	_, err := resolve(t, source, map[string]string{"a": "1.0.0"}, Options{})
+	require.Error(t, err)
+	assert.Equal(t, "no version of b matches ^9.0.0 (required by a@1.0.0)", err.Error())
+
+	_, err = resolve(t, source, map[string]string{"ghost": "^1.0.0"}, Options{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to resolve ghost@^1.0.0 (required by package.json)")
+}
+
+func TestResolveDistTags(t *testing.T) {
+	source := fakeSource{}
+	source.add("a", "1.0.0", nil, nil)
+	source.add("a", "2.0.0-beta.1", nil, nil)
+	source["a"].DistTags = map[string]string{"latest": "1.0.0", "next": "2.0.0-beta.1"}
+
+	res, err := resolve(t, source, map[string]string{"a": "next"}, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "2.0.0-beta.1", res.Root["a"])
+}
+
+func TestResolveCanceled(t *testing.T) {
+	source := fakeSource{}
+	source.add("a", "1.0.0", nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := New(source, Options{}, logger.New()).Resolve(ctx, map[string]string{"a": "^1.0.0"})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestResolveLargeGraphWithoutConflicts(t *testing.T) {
+	// More choices than the backtrack limit, none of them rejected
+	source := fakeSource{}
+	deps := make(map[string]string)
+	for i := 0; i <= maxBacktracks; i++ {
+		name := fmt.Sprintf("pkg-%d", i)
+		source.add(name, "1.0.0", nil, nil)
+		source.add(name, "1.1.0", nil, nil)
+		deps[name] = "^1.0.0"
+	}
+
+	r := New(source, Options{}, logger.New())
+	res, err := r.Resolve(context.Background(), deps)
+	require.NoError(t, err)
+	assert.Len(t, res.Packages, maxBacktracks+1)
+	assert.Equal(t, "1.1.0", res.Root["pkg-0"])
+	assert.Zero(t, r.backtracks)
+}
+
+func TestResolveRollsBackRejectedBranches(t *testing.T) {
+	source := fakeSource{}
+	source.add("plugin", "1.0.0", map[string]string{"helper": "1.0.0"}, map[string]string{"host": "^1.0.0"})
+	source.add("plugin", "2.0.0", map[string]string{"extra": "1.0.0"}, map[string]string{"host": "^2.0.0"})
+	source.add("helper", "1.0.0", nil, nil)
+	source.add("extra", "1.0.0", nil, nil)
+	source.add("host", "1.0.0", nil, nil)
+	source.add("host", "2.0.0", nil, nil)
+
+	r := New(source, Options{}, logger.New())
+	res, err := r.Resolve(context.Background(), map[string]string{"plugin": "*", "host": "^1.0.0"})
+	require.NoError(t, err)
+
+	// Nothing activated for plugin@2 survives the backtrack
+	assert.Equal(t, 1, r.backtracks)
+	assert.Equal(t, map[string]string{"plugin": "1.0.0", "host": "1.0.0"}, res.Root)
+	assert.NotContains(t, res.Packages, "extra@1.0.0")
+	assert.Contains(t, res.Packages, "helper@1.0.0")
+	assert.Len(t, res.Packages, 3)
+}
+
+func TestResolvePrefersGivenVersions(t *testing.T) {
+	source := fakeSource{}
+	source.add("a", "1.0.0", map[string]string{"b": "^1.0.0"}, nil)
+	source.add("a", "1.1.0", map[string]string{"b": "^1.0.0"}, nil)
+	source.add("b", "1.0.0", nil, nil)
+	source.add("b", "1.5.0", nil, nil)
+	source.add("b", "2.0.0", nil, nil)
+
+	opts := Options{Preferred: map[string][]string{"a": {"1.0.0"}, "b": {"1.0.0", "2.0.0"}}}
+	res, err := resolve(t, source, map[string]string{"a": "^1.0.0"}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1.0.0"}, res.Root)
+	assert.Equal(t, "1.0.0", res.Packages["a@1.0.0"].Dependencies["b"])
+
+	// A preferred version outside the range is not picked
+	res, err = resolve(t, source, map[string]string{"a": "^1.0.0", "b": "^1.2.0"}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1.0.0", "b": "1.5.0"}, res.Root)
+}
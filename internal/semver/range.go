@@ -0,0 +1,376 @@
+package semver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const xRange = `x|X|\*|0|[1-9]\d*`
+
+var (
+	partialPattern = regexp.MustCompile(`^[v=]?\s*(` + xRange + `)(?:\.(` + xRange + `)(?:\.(` + xRange + `)` +
+		`(?:-(` + prerelease + `))?(?:\+(` + build + `))?)?)?$`)
+
+	comparatorPattern = regexp.MustCompile(`^(~>|~|\^|<=|>=|<|>|=|!=)?(.*)$`)
+
+	hyphenPattern = regexp.MustCompile(`^(\S+)\s+-\s+(\S+)$`)
+
+	// operatorSpace matches whitespace between an operator and its version,
+	// which npm allows as in "> 1.2.3"
+	operatorSpace = regexp.MustCompile(`(~>|~|\^|<=|>=|<|>|=|!=)\s+`)
+
+	orSeparator = regexp.MustCompile(`\s*\|\|\s*`)
+)
+
+// comparator tests a version against a single bound. An empty operator
+// matches every release version.
+type comparator struct {
+	op      string
+	version *Version
+}
+
+func (c comparator) any() bool {
+	return c.op == ""
+}
+
+func (c comparator) test(v *Version) bool {
+	if c.any() {
+		return true
+	}
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default: // ">="
+		return cmp >= 0
+	}
+}
+
+func (c comparator) String() string {
+	switch c.op {
+	case "":
+		return "*"
+	case "=":
+		return c.version.String()
+	default:
+		return c.op + c.version.String()
+	}
+}
+
+// Range is a parsed npm version range: a union of comparator sets, each of
+// which is an intersection of comparators
+type Range struct {
+	sets [][]comparator
+}
+
+// ParseRange parses an npm range. It supports everything node-semver
+// documents: primitives (<, <=, >, >=, =), hyphen ranges (1.2.3 - 2.3.4),
+// x-ranges (1.x, 1.2.*, *), partial versions (1, 1.2), tilde and caret
+// ranges and unions joined with ||. The empty string matches any version.
+// As an extension, != excludes a single version.
+func ParseRange(s string) (*Range, error) {
+	r := &Range{}
+	for _, part := range orSeparator.Split(strings.TrimSpace(s), -1) {
+		set, err := parseSet(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q: %w", s, err)
+		}
+		r.sets = append(r.sets, set)
+	}
+	return r, nil
+}
+
+// Test reports whether v is in the range. Prerelease versions only match
+// when a comparator of the same set names a prerelease of the same
+// major.minor.patch, so ^1.2.3-beta.1 admits 1.2.3-beta.2 but not
+// 1.2.4-beta.1.
+func (r *Range) Test(v *Version) bool {
+	for _, set := range r.sets {
+		if testSet(set, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the range in its desugared form
+func (r *Range) String() string {
+	sets := make([]string, len(r.sets))
+	for i, set := range r.sets {
+		parts := make([]string, len(set))
+		for j, c := range set {
+			parts[j] = c.String()
+		}
+		sets[i] = strings.Join(parts, " ")
+	}
+	return strings.Join(sets, " || ")
+}
+
+// Satisfies reports whether version is in the range
+func Satisfies(version, rng string) (bool, error) {
+	v, err := Parse(version)
+	if err != nil {
+		return false, err
+	}
+	r, err := ParseRange(rng)
+	if err != nil {
+		return false, err
+	}
+	return r.Test(v), nil
+}
+
+// ValidRange reports whether s parses as a range
+func ValidRange(s string) bool {
+	_, err := ParseRange(s)
+	return err == nil
+}
+
+func testSet(set []comparator, v *Version) bool {
+	for _, c := range set {
+		if !c.test(v) {
+			return false
+		}
+	}
+
+	if len(v.Prerelease) == 0 {
+		return true
+	}
+	for _, c := range set {
+		if !c.any() && len(c.version.Prerelease) > 0 && c.version.sameTuple(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSet parses the comparators between two || separators
+func parseSet(s string) ([]comparator, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return []comparator{{}}, nil
+	}
+
+	if m := hyphenPattern.FindStringSubmatch(s); m != nil {
+		return parseHyphen(m[1], m[2])
+	}
+
+	var set []comparator
+	for _, token := range strings.Fields(operatorSpace.ReplaceAllString(s, "$1")) {
+		comparators, err := parseComparator(token)
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, comparators...)
+	}
+	return set, nil
+}
+
+// parseComparator desugars a single token such as ^1.2, >=1.x or 1.2.3
+func parseComparator(token string) ([]comparator, error) {
+	m := comparatorPattern.FindStringSubmatch(token)
+	op := m[1]
+	p, err := parsePartial(m[2])
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "~", "~>":
+		return p.tilde(), nil
+	case "^":
+		return p.caret(), nil
+	case "!=":
+		if p.xPatch {
+			return nil, fmt.Errorf("%s needs a full version", token)
+		}
+		return []comparator{{op: "!=", version: p.version()}}, nil
+	default:
+		return p.primitive(op), nil
+	}
+}
+
+// parseHyphen desugars "from - to" into an inclusive pair of bounds
+func parseHyphen(fromSpec, toSpec string) ([]comparator, error) {
+	from, err := parsePartial(fromSpec)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parsePartial(toSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	var set []comparator
+	if !from.xMajor {
+		set = append(set, comparator{op: ">=", version: from.floor()})
+	}
+	switch {
+	case to.xMajor:
+	case to.xMinor:
+		set = append(set, comparator{op: "<", version: upper(to.major+1, 0, 0)})
+	case to.xPatch:
+		set = append(set, comparator{op: "<", version: upper(to.major, to.minor+1, 0)})
+	default:
+		set = append(set, comparator{op: "<=", version: to.version()})
+	}
+
+	if len(set) == 0 {
+		return []comparator{{}}, nil
+	}
+	return set, nil
+}
+
+// partial is a version that may have missing or wildcard components. A
+// wildcard component makes every later one a wildcard as well.
+type partial struct {
+	major, minor, patch    uint64
+	xMajor, xMinor, xPatch bool
+	prerelease             []string
+}
+
+func parsePartial(s string) (*partial, error) {
+	m := partialPattern.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("invalid version %q", s)
+	}
+
+	p := &partial{}
+	var err error
+	if p.major, p.xMajor, err = parseComponent(m[1], false); err != nil {
+		return nil, err
+	}
+	if p.minor, p.xMinor, err = parseComponent(m[2], p.xMajor); err != nil {
+		return nil, err
+	}
+	if p.patch, p.xPatch, err = parseComponent(m[3], p.xMinor); err != nil {
+		return nil, err
+	}
+	if m[4] != "" && !p.xPatch {
+		p.prerelease = strings.Split(m[4], ".")
+	}
+	return p, nil
+}
+
+// parseComponent parses one dotted component. Missing components and
+// components following a wildcard are wildcards.
+func parseComponent(s string, wildcard bool) (uint64, bool, error) {
+	if wildcard || s == "" || s == "x" || s == "X" || s == "*" {
+		return 0, true, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid version component %q: %w", s, err)
+	}
+	return n, false, nil
+}
+
+// version returns the partial as a full version, wildcards set to zero
+func (p *partial) version() *Version {
+	return &Version{Major: p.major, Minor: p.minor, Patch: p.patch, Prerelease: p.prerelease}
+}
+
+// floor is the lowest version the partial covers
+func (p *partial) floor() *Version {
+	return p.version()
+}
+
+// primitive desugars comparisons and bare versions, turning partials into
+// the equivalent bounds: >1.2 is >=1.3.0, <=1.2 is <1.3.0-0 and 1.2 is
+// >=1.2.0 <1.3.0-0
+func (p *partial) primitive(op string) []comparator {
+	if !p.xPatch {
+		if op == "" {
+			op = "="
+		}
+		return []comparator{{op: op, version: p.version()}}
+	}
+
+	if p.xMajor {
+		if op == ">" || op == "<" {
+			return []comparator{{op: "<", version: upper(0, 0, 0)}}
+		}
+		return []comparator{{}}
+	}
+
+	switch op {
+	case ">":
+		if p.xMinor {
+			return []comparator{{op: ">=", version: &Version{Major: p.major + 1}}}
+		}
+		return []comparator{{op: ">=", version: &Version{Major: p.major, Minor: p.minor + 1}}}
+	case ">=":
+		return []comparator{{op: ">=", version: p.floor()}}
+	case "<":
+		return []comparator{{op: "<", version: upper(p.major, p.minor, 0)}}
+	case "<=":
+		if p.xMinor {
+			return []comparator{{op: "<", version: upper(p.major+1, 0, 0)}}
+		}
+		return []comparator{{op: "<", version: upper(p.major, p.minor+1, 0)}}
+	default: // "" or "=" on a partial is an x-range
+		return p.xrange()
+	}
+}
+
+// xrange desugars 1.x and 1.2.x into a pair of bounds
+func (p *partial) xrange() []comparator {
+	if p.xMinor {
+		return bounds(p.floor(), upper(p.major+1, 0, 0))
+	}
+	return bounds(p.floor(), upper(p.major, p.minor+1, 0))
+}
+
+// tilde allows patch level changes when a minor version is given and
+// minor level changes otherwise
+func (p *partial) tilde() []comparator {
+	switch {
+	case p.xMajor:
+		return []comparator{{}}
+	case p.xMinor:
+		return bounds(p.floor(), upper(p.major+1, 0, 0))
+	default:
+		return bounds(p.floor(), upper(p.major, p.minor+1, 0))
+	}
+}
+
+// caret allows changes that do not modify the left-most non-zero
+// component
+func (p *partial) caret() []comparator {
+	switch {
+	case p.xMajor:
+		return []comparator{{}}
+	case p.xMinor:
+		return bounds(p.floor(), upper(p.major+1, 0, 0))
+	case p.xPatch:
+		if p.major == 0 {
+			return bounds(p.floor(), upper(0, p.minor+1, 0))
+		}
+		return bounds(p.floor(), upper(p.major+1, 0, 0))
+	case p.major == 0 && p.minor == 0:
+		return bounds(p.floor(), upper(0, 0, p.patch+1))
+	case p.major == 0:
+		return bounds(p.floor(), upper(0, p.minor+1, 0))
+	default:
+		return bounds(p.floor(), upper(p.major+1, 0, 0))
+	}
+}
+
+func bounds(lower, upper *Version) []comparator {
+	return []comparator{{op: ">=", version: lower}, {op: "<", version: upper}}
+}
+
+// upper returns an exclusive upper bound below every prerelease of the
+// given version, so <2.0.0-0 excludes 2.0.0-beta
+func upper(major, minor, patch uint64) *Version {
+	return &Version{Major: major, Minor: minor, Patch: patch, Prerelease: []string{"0"}}
+}
@@ -0,0 +1,299 @@
+package semver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Desugared forms documented in node-semver's README
+func TestParseRangeDesugars(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		// Hyphen ranges
+		{"1.2.3 - 2.3.4", ">=1.2.3 <=2.3.4"},
+		{"1.2 - 2.3.4", ">=1.2.0 <=2.3.4"},
+		{"1.2.3 - 2.3", ">=1.2.3 <2.4.0-0"},
+		{"1.2.3 - 2", ">=1.2.3 <3.0.0-0"},
+
+		// X-ranges and partial versions
+		{"*", "*"},
+		{"", "*"},
+		{"1.x", ">=1.0.0 <2.0.0-0"},
+		{"1.2.x", ">=1.2.0 <1.3.0-0"},
+		{"2.*", ">=2.0.0 <3.0.0-0"},
+		{"1.X", ">=1.0.0 <2.0.0-0"},
+		{"1", ">=1.0.0 <2.0.0-0"},
+		{"1.2", ">=1.2.0 <1.3.0-0"},
+
+		// Tilde ranges
+		{"~1.2.3", ">=1.2.3 <1.3.0-0"},
+		{"~1.2", ">=1.2.0 <1.3.0-0"},
+		{"~1", ">=1.0.0 <2.0.0-0"},
+		{"~0.2.3", ">=0.2.3 <0.3.0-0"},
+		{"~0.2", ">=0.2.0 <0.3.0-0"},
+		{"~0", ">=0.0.0 <1.0.0-0"},
+		{"~1.2.3-beta.2", ">=1.2.3-beta.2 <1.3.0-0"},
+		{"~>1.2.3", ">=1.2.3 <1.3.0-0"},
+
+		// Caret ranges
+		{"^1.2.3", ">=1.2.3 <2.0.0-0"},
+		{"^0.2.3", ">=0.2.3 <0.3.0-0"},
+		{"^0.0.3", ">=0.0.3 <0.0.4-0"},
+		{"^1.2.3-beta.2", ">=1.2.3-beta.2 <2.0.0-0"},
+		{"^0.0.3-beta", ">=0.0.3-beta <0.0.4-0"},
+		{"^1.2.x", ">=1.2.0 <2.0.0-0"},
+		{"^0.0.x", ">=0.0.0 <0.1.0-0"},
+		{"^0.0", ">=0.0.0 <0.1.0-0"},
+		{"^1.x", ">=1.0.0 <2.0.0-0"},
+		{"^0.x", ">=0.0.0 <1.0.0-0"},
+		{"^1.2", ">=1.2.0 <2.0.0-0"},
+
+		// Primitives on partial versions
+		{">1", ">=2.0.0"},
+		{">1.2", ">=1.3.0"},
+		{">=1.2", ">=1.2.0"},
+		{"<1.2", "<1.2.0-0"},
+		{"<=1.2", "<1.3.0-0"},
+		{"<=1", "<2.0.0-0"},
+		{"=1.2", ">=1.2.0 <1.3.0-0"},
+		{">*", "<0.0.0-0"},
+
+		// Whitespace, unions and exact versions
+		{"> 1.2.3", ">1.2.3"},
+		{">= 1.2.3 < 2", ">=1.2.3 <2.0.0-0"},
+		{"=1.2.3", "1.2.3"},
+		{"v1.2.3", "1.2.3"},
+		{"1.2.7 || >=1.2.9 <2.0.0", "1.2.7 || >=1.2.9 <2.0.0"},
+		{"^1.2.3||^2", ">=1.2.3 <2.0.0-0 || >=2.0.0 <3.0.0-0"},
+		{"!=1.2.3", "!=1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			r, err := ParseRange(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, r.String())
+		})
+	}
+}
+
+func TestParseRangeInvalid(t *testing.T) {
+	for _, input := range []string{"latest", "next", "1.2.3.4", ">=>1.2.3", "^1.2.3 - 2", "!=1.2", "01.2.3", "1.2.3 -"} {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParseRange(input)
+			assert.Error(t, err)
+			assert.False(t, ValidRange(input))
+		})
+	}
+}
+
+// Cases from node-semver's range-include fixtures
+func TestRangeIncludes(t *testing.T) {
+	tests := [][2]string{
+		{"1.0.0 - 2.0.0", "1.2.3"},
+		{"^1.2.3+build", "1.2.3"},
+		{"^1.2.3+build", "1.3.0"},
+		{"1.2.3-pre+asdf - 2.4.3-pre+asdf", "1.2.3"},
+		{"1.2.3-pre+asdf - 2.4.3-pre+asdf", "1.2.3-pre.2"},
+		{"1.2.3-pre+asdf - 2.4.3-pre+asdf", "2.4.3-alpha"},
+		{"1.2.3+asdf - 2.4.3+asdf", "1.2.3"},
+		{"1.0.0", "1.0.0"},
+		{">=*", "0.2.4"},
+		{"", "1.0.0"},
+		{"*", "1.2.3"},
+		{"*", "v1.2.3"},
+		{">=1.0.0", "1.0.0"},
+		{">=1.0.0", "1.0.1"},
+		{">=1.0.0", "1.1.0"},
+		{">1.0.0", "1.0.1"},
+		{">1.0.0", "1.1.0"},
+		{"<=2.0.0", "2.0.0"},
+		{"<=2.0.0", "1.9999.9999"},
+		{"<=2.0.0", "0.2.9"},
+		{"<2.0.0", "1.9999.9999"},
+		{"<2.0.0", "0.2.9"},
+		{">= 1.0.0", "1.0.0"},
+		{">=  1.0.0", "1.0.1"},
+		{">   1.0.0", "1.0.1"},
+		{"<=   2.0.0", "2.0.0"},
+		{"<    2.0.0", "0.2.9"},
+		{">=0.1.97", "v0.1.97"},
+		{">=0.1.97", "0.1.97"},
+		{"0.1.20 || 1.2.4", "1.2.4"},
+		{">=0.2.3 || <0.0.1", "0.0.0"},
+		{">=0.2.3 || <0.0.1", "0.2.3"},
+		{">=0.2.3 || <0.0.1", "0.2.4"},
+		{"||", "1.3.4"},
+		{"2.x.x", "2.1.3"},
+		{"1.2.x", "1.2.3"},
+		{"1.2.x || 2.x", "2.1.3"},
+		{"1.2.x || 2.x", "1.2.3"},
+		{"x", "1.2.3"},
+		{"2.*.*", "2.1.3"},
+		{"1.2.*", "1.2.3"},
+		{"1.2.* || 2.*", "2.1.3"},
+		{"1.2.* || 2.*", "1.2.3"},
+		{"2", "2.1.2"},
+		{"2.3", "2.3.1"},
+		{"~0.0.1", "0.0.1"},
+		{"~0.0.1", "0.0.2"},
+		{"~x", "0.0.9"},
+		{"~2", "2.0.9"},
+		{"~2.4", "2.4.0"},
+		{"~2.4", "2.4.5"},
+		{"~>3.2.1", "3.2.2"},
+		{"~1", "1.2.3"},
+		{"~>1", "1.2.3"},
+		{"~> 1", "1.2.3"},
+		{"~1.0", "1.0.2"},
+		{"~ 1.0", "1.0.2"},
+		{"~ 1.0.3", "1.0.12"},
+		{">=1", "1.0.0"},
+		{">= 1", "1.0.0"},
+		{"<1.2", "1.1.1"},
+		{"< 1.2", "1.1.1"},
+		{"~v0.5.4-pre", "0.5.5"},
+		{"~v0.5.4-pre", "0.5.4"},
+		{"=0.7.x", "0.7.2"},
+		{"<=0.7.x", "0.7.2"},
+		{">=0.7.x", "0.7.2"},
+		{"<=0.7.x", "0.6.2"},
+		{"~1.2.1 >=1.2.3", "1.2.3"},
+		{"~1.2.1 =1.2.3", "1.2.3"},
+		{"~1.2.1 1.2.3", "1.2.3"},
+		{"~1.2.1 >=1.2.3 1.2.3", "1.2.3"},
+		{"~1.2.1 1.2.3 >=1.2.3", "1.2.3"},
+		{">=1.2.1 1.2.3", "1.2.3"},
+		{"1.2.3 >=1.2.1", "1.2.3"},
+		{">=1.2.3 >=1.2.1", "1.2.3"},
+		{">=1.2.1 >=1.2.3", "1.2.3"},
+		{">=1.2", "1.2.8"},
+		{"^1.2.3", "1.8.1"},
+		{"^0.1.2", "0.1.2"},
+		{"^0.1", "0.1.2"},
+		{"^0.0.1", "0.0.1"},
+		{"^1.2", "1.4.2"},
+		{"^1.2 ^1", "1.4.2"},
+		{"^1.2.3-alpha", "1.2.3-pre"},
+		{"^1.2.0-alpha", "1.2.0-pre"},
+		{"^0.0.1-alpha", "0.0.1-beta"},
+		{"^0.0.1-alpha", "0.0.1"},
+		{"^0.1.1-alpha", "0.1.1-beta"},
+		{"^x", "1.2.3"},
+		{"x - 1.0.0", "0.9.7"},
+		{"x - 1.x", "0.9.7"},
+		{"1.0.0 - x", "1.9.7"},
+		{"1.x - x", "1.9.7"},
+		{"<=7.x", "7.9.9"},
+		{"!=1.2.3", "1.2.4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt[0]+" includes "+tt[1], func(t *testing.T) {
+			ok, err := Satisfies(tt[1], tt[0])
+			require.NoError(t, err)
+			assert.True(t, ok)
+		})
+	}
+}
+
+// Cases from node-semver's range-exclude fixtures
+func TestRangeExcludes(t *testing.T) {
+	tests := [][2]string{
+		{"1.0.0 - 2.0.0", "2.2.3"},
+		{"1.2.3+asdf - 2.4.3+asdf", "1.2.3-pre.2"},
+		{"1.2.3+asdf - 2.4.3+asdf", "2.4.3-alpha"},
+		{"^1.2.3+build", "2.0.0"},
+		{"^1.2.3+build", "1.2.0"},
+		{"^1.2.3", "1.2.3-pre"},
+		{"^1.2", "1.2.0-pre"},
+		{">1.2", "1.3.0-beta"},
+		{"<=1.2.3", "1.2.3-beta"},
+		{"^1.2.3", "1.2.3-beta"},
+		{"=0.7.x", "0.7.0-asdf"},
+		{">=0.7.x", "0.7.0-asdf"},
+		{"<=0.7.x", "0.7.0-asdf"},
+		{"1", "1.0.0beta"},
+		{"1.0.0", "1.0.1"},
+		{">=1.0.0", "0.0.0"},
+		{">=1.0.0", "0.0.1"},
+		{">=1.0.0", "0.1.0"},
+		{">1.0.0", "0.0.1"},
+		{">1.0.0", "0.1.0"},
+		{"<=2.0.0", "3.0.0"},
+		{"<=2.0.0", "2.9999.9999"},
+		{"<=2.0.0", "2.2.9"},
+		{"<2.0.0", "2.9999.9999"},
+		{"<2.0.0", "2.2.9"},
+		{">=0.1.97", "v0.1.93"},
+		{">=0.1.97", "0.1.93"},
+		{"0.1.20 || 1.2.4", "1.2.3"},
+		{">=0.2.3 || <0.0.1", "0.0.3"},
+		{">=0.2.3 || <0.0.1", "0.2.2"},
+		{"2.x.x", "1.1.3"},
+		{"2.x.x", "3.1.3"},
+		{"1.2.x", "1.3.3"},
+		{"1.2.x || 2.x", "3.1.3"},
+		{"1.2.x || 2.x", "1.1.3"},
+		{"2.*.*", "1.1.3"},
+		{"2.*.*", "3.1.3"},
+		{"1.2.*", "1.3.3"},
+		{"1.2.* || 2.*", "3.1.3"},
+		{"1.2.* || 2.*", "1.1.3"},
+		{"2", "1.1.2"},
+		{"2.3", "2.4.1"},
+		{"~0.0.1", "0.1.0-alpha"},
+		{"~0.0.1", "0.1.0"},
+		{"~2.4", "2.5.0"},
+		{"~2.4", "2.3.9"},
+		{"~>3.2.1", "3.3.2"},
+		{"~>3.2.1", "3.2.0"},
+		{"~1", "0.2.3"},
+		{"~>1", "2.2.3"},
+		{"~1.0", "1.1.0"},
+		{"<1", "1.0.0"},
+		{">=1.2", "1.1.1"},
+		{"1", "2.0.0beta"},
+		{"~v0.5.4-beta", "0.5.4-alpha"},
+		{"=0.7.x", "0.8.2"},
+		{">=0.7.x", "0.6.2"},
+		{"<0.7.x", "0.7.2"},
+		{"<1.2.3", "1.2.3-beta"},
+		{"=1.2.3", "1.2.3-beta"},
+		{">1.2", "1.2.8"},
+		{"^0.0.1", "0.0.2-alpha"},
+		{"^0.0.1", "0.0.2"},
+		{"^1.2.3", "2.0.0-alpha"},
+		{"^1.2.3", "1.2.2"},
+		{"^1.2", "1.1.9"},
+		{"*", "v1.2.3-foo"},
+		{"^1.0.0", "2.0.0-rc1"},
+		{"1 - 2", "2.0.0-pre"},
+		{"1 - 2", "1.0.0-pre"},
+		{"1.1.x", "1.0.0-a"},
+		{"1.1.x", "1.1.0-a"},
+		{"1.1.x", "1.2.0-a"},
+		{"1.x", "1.0.0-a"},
+		{"1.x", "1.1.0-a"},
+		{"1.x", "1.2.0-a"},
+		{">=1.0.0 <1.1.0", "1.1.0"},
+		{">=1.0.0 <1.1.0", "1.1.0-pre"},
+		{">=1.0.0 <1.1.0-pre", "1.1.0-pre"},
+		{"!=1.2.3", "1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt[0]+" excludes "+tt[1], func(t *testing.T) {
+			ok, err := Satisfies(tt[1], tt[0])
+			if err != nil {
+				// Versions npm cannot parse never satisfy a range
+				return
+			}
+			assert.False(t, ok)
+		})
+	}
+}
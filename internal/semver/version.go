@@ -0,0 +1,150 @@
+// Package semver implements versions and ranges with the semantics of
+// node-semver, which is what npm uses to interpret package.json
+// specifiers.
+package semver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	numericIdentifier = `0|[1-9]\d*`
+	prereleaseIdent   = `(?:0|[1-9]\d*|\d*[a-zA-Z-][a-zA-Z0-9-]*)`
+	prerelease        = prereleaseIdent + `(?:\.` + prereleaseIdent + `)*`
+	build             = `[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*`
+)
+
+var versionPattern = regexp.MustCompile(`^[v=]?\s*(` + numericIdentifier + `)\.(` + numericIdentifier + `)\.(` + numericIdentifier + `)` +
+	`(?:-(` + prerelease + `))?(?:\+(` + build + `))?$`)
+
+// Version is a parsed semantic version
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease []string
+	Build      []string
+}
+
+// Parse parses a full version such as 1.2.3 or v1.2.3-beta.1+build.5
+func Parse(s string) (*Version, error) {
+	m := versionPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return nil, fmt.Errorf("invalid version %q", s)
+	}
+
+	v := &Version{}
+	var err error
+	if v.Major, err = strconv.ParseUint(m[1], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid version %q: %w", s, err)
+	}
+	if v.Minor, err = strconv.ParseUint(m[2], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid version %q: %w", s, err)
+	}
+	if v.Patch, err = strconv.ParseUint(m[3], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid version %q: %w", s, err)
+	}
+	if m[4] != "" {
+		v.Prerelease = strings.Split(m[4], ".")
+	}
+	if m[5] != "" {
+		v.Build = strings.Split(m[5], ".")
+	}
+	return v, nil
+}
+
+// String formats the version without a leading v
+func (v *Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	if len(v.Build) > 0 {
+		s += "+" + strings.Join(v.Build, ".")
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 when v sorts before, equal to or after o.
+// Build metadata does not take part in the ordering.
+func (v *Version) Compare(o *Version) int {
+	if c := compareInts(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareInts(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareInts(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+// Compare parses and compares two versions
+func Compare(a, b string) (int, error) {
+	va, err := Parse(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := Parse(b)
+	if err != nil {
+		return 0, err
+	}
+	return va.Compare(vb), nil
+}
+
+// sameTuple reports whether v and o share major, minor and patch
+func (v *Version) sameTuple(o *Version) bool {
+	return v.Major == o.Major && v.Minor == o.Minor && v.Patch == o.Patch
+}
+
+// comparePrerelease orders prerelease identifiers. A version without a
+// prerelease sorts after any prerelease of the same version.
+func comparePrerelease(a, b []string) int {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return 1
+	case len(b) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareIdentifiers(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(uint64(len(a)), uint64(len(b)))
+}
+
+// compareIdentifiers compares numeric identifiers numerically, sorts them
+// before alphanumeric ones and compares the rest lexically
+func compareIdentifiers(a, b string) int {
+	na, errA := strconv.ParseUint(a, 10, 64)
+	nb, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInts(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func compareInts(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
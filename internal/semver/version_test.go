@@ -0,0 +1,96 @@
+package semver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "1.2.3", want: "1.2.3"},
+		{input: "v1.2.3", want: "1.2.3"},
+		{input: "=1.2.3", want: "1.2.3"},
+		{input: " 1.2.3 ", want: "1.2.3"},
+		{input: "1.2.3-beta.1", want: "1.2.3-beta.1"},
+		{input: "1.2.3-0.3.7", want: "1.2.3-0.3.7"},
+		{input: "1.2.3-x.7.z.92", want: "1.2.3-x.7.z.92"},
+		{input: "1.2.3+build.5", want: "1.2.3+build.5"},
+		{input: "1.2.3-rc.1+exp.sha.5114f85", want: "1.2.3-rc.1+exp.sha.5114f85"},
+		{input: "1.2", wantErr: true},
+		{input: "1.2.x", wantErr: true},
+		{input: "01.2.3", wantErr: true},
+		{input: "1.2.3-01", wantErr: true},
+		{input: "1.2.3-", wantErr: true},
+		{input: "latest", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, err := Parse(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, v.String())
+		})
+	}
+}
+
+// Pairs from node-semver's comparison fixtures: the first version is
+// greater than the second
+func TestCompare(t *testing.T) {
+	tests := [][2]string{
+		{"0.0.0", "0.0.0-foo"},
+		{"0.0.1", "0.0.0"},
+		{"1.0.0", "0.9.9"},
+		{"0.10.0", "0.9.0"},
+		{"0.99.0", "0.10.0"},
+		{"2.0.0", "1.2.3"},
+		{"v0.0.0", "0.0.0-foo"},
+		{"v0.0.1", "0.0.0"},
+		{"1.2.3", "1.2.3-asdf"},
+		{"1.2.3", "1.2.3-4"},
+		{"1.2.3", "1.2.3-4-foo"},
+		{"1.2.3-5-foo", "1.2.3-5"},
+		{"1.2.3-5", "1.2.3-4"},
+		{"1.2.3-5-foo", "1.2.3-5-Foo"},
+		{"3.0.0", "2.7.2+asdf"},
+		{"1.2.3-a.10", "1.2.3-a.5"},
+		{"1.2.3-a.b", "1.2.3-a.5"},
+		{"1.2.3-a.b", "1.2.3-a"},
+		{"1.2.3-a.b.c.10.d.5", "1.2.3-a.b.c.5.d.100"},
+		{"1.2.3-r2", "1.2.3-r100"},
+		{"1.2.3-r100", "1.2.3-R2"},
+		{"1.0.0-rc.1", "1.0.0-beta.11"},
+		{"1.0.0-beta.11", "1.0.0-beta.2"},
+		{"1.0.0-beta.2", "1.0.0-beta"},
+		{"1.0.0-beta", "1.0.0-alpha.beta"},
+		{"1.0.0-alpha.beta", "1.0.0-alpha.1"},
+		{"1.0.0-alpha.1", "1.0.0-alpha"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt[0]+" > "+tt[1], func(t *testing.T) {
+			c, err := Compare(tt[0], tt[1])
+			require.NoError(t, err)
+			assert.Equal(t, 1, c)
+
+			c, err = Compare(tt[1], tt[0])
+			require.NoError(t, err)
+			assert.Equal(t, -1, c)
+		})
+	}
+
+	// Build metadata is ignored
+	c, err := Compare("1.2.3+build.1", "1.2.3+build.2")
+	require.NoError(t, err)
+	assert.Equal(t, 0, c)
+}
@@ -0,0 +1,294 @@
+package store
+
+import (
+	"archive/tar"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/marpit19/zap-pm/internal/extractor"
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/marpit19/zap-pm/internal/registry"
+)
+
+const (
+	layoutVersion = "v1"
+	filesDir      = "files"
+	indexDir      = "index"
+	tmpDir        = "tmp"
+
+	executableSuffix = "-exec"
+)
+
+// link creates hardlinks; tests replace it to exercise the copy fallback
+var link = os.Link
+
+// Store is a content-addressable package store. Every file of every
+// imported package is kept once, named after the SHA-512 of its content,
+// and project node_modules directories are populated with hardlinks.
+type Store struct {
+	root string
+	log  *logger.Logger
+}
+
+// FileEntry is a single file of an imported package
+type FileEntry struct {
+	Hash string      `json:"hash,omitempty"` // hex SHA-512 of the content
+	Mode os.FileMode `json:"mode,omitempty"`
+	Size int64       `json:"size"`
+	Link string      `json:"link,omitempty"` // symlink target
+}
+
+// Index lists the files of an imported package, keyed by package relative
+// slash separated path
+type Index struct {
+	Name      string               `json:"name"`
+	Version   string               `json:"version"`
+	Integrity string               `json:"integrity"` // SRI digest of the imported tarball
+	Files     map[string]FileEntry `json:"files"`
+}
+
+// New creates a store rooted at dir
+func New(dir string, log *logger.Logger) *Store {
+	return &Store{
+		root: filepath.Join(dir, layoutVersion),
+		log:  log,
+	}
+}
+
+// Import adds the files of a package tarball with the given SRI integrity
+// to the store and returns its index. Packages that were imported before
+// are not unpacked again, unless their tarball had another integrity, as
+// happens when the same name@version comes from another registry or was
+// republished.
+func (s *Store) Import(name, version, integrity, tarball string) (*Index, error) {
+	// Both name the index file of the package
+	if err := registry.ValidatePackage(name, version); err != nil {
+		return nil, err
+	}
+
+	if index, err := s.readIndex(name, version); err == nil && index.Integrity == integrity && s.complete(index) {
+		s.log.Debugf("Store hit for %s@%s", name, version)
+		return index, nil
+	}
+
+	f, err := os.Open(tarball)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer f.Close()
+
+	if err := os.MkdirAll(filepath.Join(s.root, tmpDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	index := &Index{
+		Name:      name,
+		Version:   version,
+		Integrity: integrity,
+		Files:     make(map[string]FileEntry),
+	}
+
+	err = extractor.Walk(f, func(entry *extractor.Entry) error {
+		switch entry.Type {
+		case tar.TypeReg:
+			file, err := s.addFile(entry.Reader, entry.Mode)
+			if err != nil {
+				return fmt.Errorf("failed to store %s: %w", entry.Path, err)
+			}
+			index.Files[entry.Path] = file
+
+		case tar.TypeLink:
+			index.Files[entry.Path] = index.Files[entry.Linkname]
+
+		case tar.TypeSymlink:
+			index.Files[entry.Path] = FileEntry{Link: entry.Linkname}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to import %s@%s: %w", name, version, err)
+	}
+
+	if err := s.writeIndex(index); err != nil {
+		return nil, err
+	}
+
+	s.log.Debugf("Imported %s@%s into the store (%d files)", name, version, len(index.Files))
+	return index, nil
+}
+
+// Link materializes an imported package at dest. Files are hardlinked from
+// the store and copied when hardlinks are not possible, for example when
+// the project lives on a different filesystem.
+func (s *Store) Link(index *Index, dest string) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dest, err)
+	}
+
+	copied := 0
+	for rel, file := range index.Files {
+		target := filepath.Join(dest, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", rel, err)
+		}
+
+		if file.Link != "" {
+			if err := os.Symlink(filepath.FromSlash(file.Link), target); err != nil {
+				return fmt.Errorf("failed to create symlink %s: %w", rel, err)
+			}
+			continue
+		}
+
+		source := s.filePath(file.Hash, file.Mode)
+		if err := link(source, target); err == nil {
+			continue
+		}
+
+		if err := copyFile(source, target, file.Mode); err != nil {
+			return fmt.Errorf("failed to link %s: %w", rel, err)
+		}
+		copied++
+	}
+
+	if copied > 0 {
+		s.log.Debugf("Copied %d files of %s@%s, hardlinks unavailable", copied, index.Name, index.Version)
+	}
+	return nil
+}
+
+// addFile streams content into the store and returns its entry
+func (s *Store) addFile(r io.Reader, mode os.FileMode) (FileEntry, error) {
+	tmp, err := os.CreateTemp(filepath.Join(s.root, tmpDir), "file-*")
+	if err != nil {
+		return FileEntry{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha512.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if err != nil {
+		tmp.Close()
+		return FileEntry{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return FileEntry{}, err
+	}
+
+	entry := FileEntry{
+		Hash: hex.EncodeToString(hash.Sum(nil)),
+		Mode: mode,
+		Size: size,
+	}
+
+	target := s.filePath(entry.Hash, mode)
+	if _, err := os.Stat(target); err == nil {
+		return entry, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return FileEntry{}, err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return FileEntry{}, err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return FileEntry{}, err
+	}
+	return entry, nil
+}
+
+// filePath returns where content with the given hash is stored. Executable
+// files are kept apart, since hardlinks share their permission bits.
+func (s *Store) filePath(hash string, mode os.FileMode) string {
+	name := hash[2:]
+	if mode&0111 != 0 {
+		name += executableSuffix
+	}
+	return filepath.Join(s.root, filesDir, hash[:2], name)
+}
+
+// complete reports whether every file referenced by index is present
+func (s *Store) complete(index *Index) bool {
+	for _, file := range index.Files {
+		if file.Link != "" {
+			continue
+		}
+		if _, err := os.Stat(s.filePath(file.Hash, file.Mode)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Store) indexPath(name, version string) string {
+	return filepath.Join(s.root, indexDir, filepath.FromSlash(name), version+".json")
+}
+
+func (s *Store) readIndex(name, version string) (*Index, error) {
+	data, err := os.ReadFile(s.indexPath(name, version))
+	if err != nil {
+		return nil, err
+	}
+
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+// writeIndex stores an index through a temporary file, so readers never
+// observe a partially written index
+func (s *Store) writeIndex(index *Index) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("failed to marshal store index: %w", err)
+	}
+
+	path := s.indexPath(index.Name, index.Version)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create store index directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(s.root, tmpDir), "index-*")
+	if err != nil {
+		return fmt.Errorf("failed to write store index: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write store index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write store index: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write store index: %w", err)
+	}
+	return nil
+}
+
+// copyFile copies a store file to target
+func copyFile(source, target string, mode os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/marpit19/zap-pm/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTarball writes an npm style tarball with the given files to dir
+func writeTarball(t *testing.T, dir string, files map[string]string, modes map[string]int64) string {
+	path := filepath.Join(dir, "package.tgz")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, body := range files {
+		mode := modes[name]
+		if mode == 0 {
+			mode = 0644
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "package/" + name, Mode: mode, Size: int64(len(body))}))
+		_, err := tw.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "package/main.js", Typeflag: tar.TypeSymlink, Linkname: "index.js"}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return path
+}
+
+func countStoreFiles(t *testing.T, s *Store) int {
+	count := 0
+	err := filepath.Walk(filepath.Join(s.root, filesDir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			count++
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	return count
+}
+
+func TestImportDeduplicatesContent(t *testing.T) {
+	s := New(t.TempDir(), logger.New())
+
+	first := writeTarball(t, t.TempDir(), map[string]string{
+		"index.js":   "module.exports = 1",
+		"LICENSE":    "MIT",
+		"bin/cli.js": "#!/usr/bin/env node",
+	}, map[string]int64{"bin/cli.js": 0755})
+	second := writeTarball(t, t.TempDir(), map[string]string{
+		"index.js": "module.exports = 2",
+		"LICENSE":  "MIT",
+	}, nil)
+
+	index1, err := s.Import("first", "1.0.0", "sha512-test", first)
+	require.NoError(t, err)
+	index2, err := s.Import("second", "1.0.0", "sha512-test", second)
+	require.NoError(t, err)
+
+	// LICENSE is shared, so four distinct files end up in the store
+	assert.Equal(t, 4, countStoreFiles(t, s))
+	assert.Equal(t, index1.Files["LICENSE"].Hash, index2.Files["LICENSE"].Hash)
+	assert.Equal(t, "index.js", index1.Files["main.js"].Link)
+	assert.Equal(t, os.FileMode(0755), index1.Files["bin/cli.js"].Mode)
+
+	// Importing again reuses the stored index
+	require.NoError(t, os.Remove(first))
+	again, err := s.Import("first", "1.0.0", "sha512-test", first)
+	require.NoError(t, err)
+	assert.Equal(t, index1, again)
+}
+
+func TestLinkUsesHardlinks(t *testing.T) {
+	s := New(t.TempDir(), logger.New())
+	tarball := writeTarball(t, t.TempDir(), map[string]string{
+		"index.js":   "module.exports = 1",
+		"bin/cli.js": "#!/usr/bin/env node",
+	}, map[string]int64{"bin/cli.js": 0755})
+
+	index, err := s.Import("pkg", "1.0.0", "sha512-test", tarball)
+	require.NoError(t, err)
+
+	projectA := filepath.Join(t.TempDir(), "node_modules", "pkg")
+	projectB := filepath.Join(t.TempDir(), "node_modules", "pkg")
+	require.NoError(t, s.Link(index, projectA))
+	require.NoError(t, s.Link(index, projectB))
+
+	infoA, err := os.Stat(filepath.Join(projectA, "index.js"))
+	require.NoError(t, err)
+	infoB, err := os.Stat(filepath.Join(projectB, "index.js"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(infoA, infoB), "projects should share the stored file")
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(projectA, "bin", "cli.js"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+		content, err := os.ReadFile(filepath.Join(projectA, "main.js"))
+		require.NoError(t, err)
+		assert.Equal(t, "module.exports = 1", string(content))
+	}
+}
+
+func TestLinkFallsBackToCopy(t *testing.T) {
+	s := New(t.TempDir(), logger.New())
+	tarball := writeTarball(t, t.TempDir(), map[string]string{"index.js": "module.exports = 1"}, nil)
+
+	index, err := s.Import("pkg", "1.0.0", "sha512-test", tarball)
+	require.NoError(t, err)
+
+	link = func(oldname, newname string) error {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errors.New("cross-device link")}
+	}
+	defer func() { link = os.Link }()
+
+	dest := filepath.Join(t.TempDir(), "pkg")
+	require.NoError(t, s.Link(index, dest))
+
+	content, err := os.ReadFile(filepath.Join(dest, "index.js"))
+	require.NoError(t, err)
+	assert.Equal(t, "module.exports = 1", string(content))
+
+	stored, err := os.Stat(s.filePath(index.Files["index.js"].Hash, index.Files["index.js"].Mode))
+	require.NoError(t, err)
+	copied, err := os.Stat(filepath.Join(dest, "index.js"))
+	require.NoError(t, err)
+	assert.False(t, os.SameFile(stored, copied))
+}
+
+func TestImportRepairsMissingFiles(t *testing.T) {
+	s := New(t.TempDir(), logger.New())
+	tarball := writeTarball(t, t.TempDir(), map[string]string{"index.js": "module.exports = 1"}, nil)
+
+	index, err := s.Import("pkg", "1.0.0", "sha512-test", tarball)
+	require.NoError(t, err)
+
+	stored := s.filePath(index.Files["index.js"].Hash, index.Files["index.js"].Mode)
+	require.NoError(t, os.Remove(stored))
+
+	_, err = s.Import("pkg", "1.0.0", "sha512-test", tarball)
+	require.NoError(t, err)
+	assert.FileExists(t, stored)
+}
+
+func TestImportRejectsInvalidNames(t *testing.T) {
+	root := t.TempDir()
+	s := New(filepath.Join(root, "store"), logger.New())
+	tarball := writeTarball(t, t.TempDir(), map[string]string{"index.js": "module.exports = 1"}, nil)
+
+	_, err := s.Import("../../../evil", "1.0.0", "sha512-test", tarball)
+	assert.Error(t, err)
+	_, err = s.Import("pkg", "../1.0.0", "sha512-test", tarball)
+	assert.Error(t, err)
+
+	entries, err := os.ReadDir(root)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestImportReplacesIndexOfOtherTarball(t *testing.T) {
+	s := New(t.TempDir(), logger.New())
+	original := writeTarball(t, t.TempDir(), map[string]string{"index.js": "module.exports = 1"}, nil)
+	republished := writeTarball(t, t.TempDir(), map[string]string{
+		"index.js": "module.exports = 2",
+		"LICENSE":  "MIT",
+	}, nil)
+
+	index, err := s.Import("pkg", "1.0.0", "sha512-original", original)
+	require.NoError(t, err)
+	assert.Len(t, index.Files, 2)
+
+	// The same name@version with another tarball is imported again
+	index, err = s.Import("pkg", "1.0.0", "sha512-republished", republished)
+	require.NoError(t, err)
+	assert.Len(t, index.Files, 3)
+	assert.Equal(t, "sha512-republished", index.Integrity)
+
+	again, err := s.readIndex("pkg", "1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, index, again)
+}